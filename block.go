@@ -26,12 +26,14 @@ type Block struct {
 	// Hash to the previous block
 	PrevHash []byte
 	// Uncles of this block
-	Uncles   []*Block
+	Uncles   []*BlockHeader
 	UncleSha []byte
 	// The coin base address
 	Coinbase []byte
 	// Block Trie state
 	state *ethutil.Trie
+	// Database the state and the storage of its contracts live in
+	db Database
 	// Difficulty for the current block
 	Difficulty *big.Int
 	// Creation time
@@ -45,15 +47,15 @@ type Block struct {
 	Extra string
 }
 
-// New block takes a raw encoded string
+// New block takes a raw encoded string. Blocks decoded on their own, like
+// the ones received from peers, have no database. Their state can't be read
+// until a block chain imports them into its own database.
 func NewBlockFromData(raw []byte) *Block {
-	block := &Block{}
-	block.RlpDecode(raw)
-
-	return block
+	return newBlockFromData(nil, raw)
 }
 
-// New block takes a raw encoded string
+// New block takes a raw encoded string. The block has no database, see
+// NewBlockFromData
 func NewBlockFromRlpValue(rlpValue *ethutil.RlpValue) *Block {
 	block := &Block{}
 	block.RlpValueDecode(rlpValue)
@@ -61,6 +63,14 @@ func NewBlockFromRlpValue(rlpValue *ethutil.RlpValue) *Block {
 	return block
 }
 
+// Decodes a block whose state lives in db
+func newBlockFromData(db Database, raw []byte) *Block {
+	block := &Block{db: db}
+	block.RlpDecode(raw)
+
+	return block
+}
+
 // Creates a new block. This is currently for testing
 func CreateTestBlock( /* TODO use raw data */ transactions []*Transaction) *Block {
 	block := &Block{
@@ -76,7 +86,10 @@ func CreateTestBlock( /* TODO use raw data */ transactions []*Transaction) *Bloc
 	return block
 }
 
-func CreateBlock(root interface{},
+// Creates a block including txes on top of the state at root. The
+// transactions aren't applied to the state, ApplyTransactions does that.
+func CreateBlock(db Database,
+	root interface{},
 	prevHash []byte,
 	base []byte,
 	Difficulty *big.Int,
@@ -96,30 +109,61 @@ func CreateBlock(root interface{},
 		UncleSha:     EmptyShaList,
 
 		// TODO
-		Uncles: []*Block{},
+		Uncles: []*BlockHeader{},
 	}
 	block.SetTransactions(txes)
 
-	block.state = ethutil.NewTrie(ethutil.Config.Db, root)
-
-	for _, tx := range txes {
-		block.MakeContract(tx)
-	}
+	block.db = db
+	block.state = ethutil.NewTrie(block.db, root)
 
 	return block
 }
 
-// Returns a hash of the block
+// Returns the hash of the block including the nonce
 func (block *Block) Hash() []byte {
-	//genesisHeader(8 items) is ["", sha3(rlp([])), "", "", sha3(rlp([])), 2^32, 0, ""]
-	return ethutil.Sha3Bin(ethutil.Encode([]interface{}{block.PrevHash,
-		block.UncleSha, block.Coinbase, block.state.Root, block.TxSha, block.Difficulty, block.Time, block.Extra}))
+	return block.Header().Hash()
+}
+
+// Returns the hash of the block without the nonce which is used as the input
+// of the proof of work
+func (block *Block) HashNoNonce() []byte {
+	return block.Header().HashNoNonce()
+}
+
+// Returns the header of the block
+func (block *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		PrevHash:   block.PrevHash,
+		UncleSha:   block.UncleSha,
+		Coinbase:   block.Coinbase,
+		Root:       block.state.Root,
+		TxSha:      block.TxSha,
+		Difficulty: block.Difficulty,
+		Time:       block.Time,
+		Nonce:      block.Nonce,
+		Extra:      block.Extra,
+	}
 }
 
 func (block *Block) State() *ethutil.Trie {
 	return block.state
 }
 
+// Returns a copy of the block with a separate state trie starting at the
+// given root. Changes to the copy's state don't affect the original block.
+func (block *Block) CopyWithState(root interface{}) *Block {
+	return block.copyWithState(block.db, root)
+}
+
+// Like CopyWithState but the copy's state lives in db
+func (block *Block) copyWithState(db Database, root interface{}) *Block {
+	cpy := *block
+	cpy.db = db
+	cpy.state = ethutil.NewTrie(db, root)
+
+	return &cpy
+}
+
 func (block *Block) Transactions() []*Transaction {
 	return block.transactions
 }
@@ -130,10 +174,7 @@ func (block *Block) GetContract(addr []byte) *Contract {
 		return nil
 	}
 
-	contract := &Contract{}
-	contract.RlpDecode([]byte(data))
-
-	return contract
+	return newContractFromData(block.db, []byte(data))
 }
 func (block *Block) UpdateContract(addr []byte, contract *Contract) {
 	block.state.Update(string(addr), string(contract.RlpEncode()))
@@ -155,35 +196,42 @@ func (block *Block) UpdateAddr(addr []byte, address *Address) {
 	block.state.Update(string(addr), string(address.RlpEncode()))
 }
 
-func (block *Block) PayFee(addr []byte, fee *big.Int) bool {
-	contract := block.GetContract(addr)
-	// If we can't pay the fee return
-	if contract == nil || contract.Amount.Cmp(fee) < 0 /* amount < fee */ {
-		fmt.Println("Contract has insufficient funds", contract.Amount, fee)
-
-		return false
+// Moves the fee from the account at addr to the coinbase. Fails if the
+// account can't pay it
+func (block *Block) PayFee(addr []byte, fee *big.Int) error {
+	if fee.Sign() == 0 {
+		return nil
 	}
 
-	base := new(big.Int)
-	contract.Amount = base.Sub(contract.Amount, fee)
-	block.state.Update(string(addr), string(contract.RlpEncode()))
-
-	data := block.state.Get(string(block.Coinbase))
+	payer := block.GetContract(addr)
+	// If we can't pay the fee return
+	if payer == nil || payer.Amount.Cmp(fee) < 0 /* amount < fee */ {
+		return fmt.Errorf("Insufficient funds in %x to pay fee %v", addr, fee)
+	}
 
-	// Get the ether (Coinbase) and add the fee (gief fee to miner)
-	ether := NewAddressFromData([]byte(data))
+	payer.Amount = new(big.Int).Sub(payer.Amount, fee)
+	block.UpdateContract(addr, payer)
 
-	base = new(big.Int)
-	ether.Amount = base.Add(ether.Amount, fee)
+	// Gief fee to miner
+	block.addBalance(block.Coinbase, fee)
 
-	block.state.Update(string(block.Coinbase), string(ether.RlpEncode()))
+	return nil
+}
 
-	return true
+// Adds amount to the balance of the account at addr. The storage of a
+// contract is left intact
+func (block *Block) addBalance(addr []byte, amount *big.Int) {
+	if contract := block.GetContract(addr); contract != nil {
+		contract.Amount = new(big.Int).Add(contract.Amount, amount)
+		block.UpdateContract(addr, contract)
+	} else {
+		block.UpdateAddr(addr, NewAddress(new(big.Int).Set(amount)))
+	}
 }
 
 func (block *Block) BlockInfo() BlockInfo {
 	bi := BlockInfo{}
-	data, _ := ethutil.Config.Db.Get(append(block.Hash(), []byte("Info")...))
+	data, _ := block.db.Get(append(block.Hash(), []byte("Info")...))
 	bi.RlpDecode(data)
 
 	return bi
@@ -195,7 +243,7 @@ func (block *Block) MakeContract(tx *Transaction) {
 		addr := tx.Hash()
 
 		value := tx.Value
-		contract := NewContract(value, []byte(""))
+		contract := NewContract(block.db, value, []byte(""))
 		block.state.Update(string(addr), string(contract.RlpEncode()))
 		for i, val := range tx.Data {
 			contract.state.Update(string(ethutil.NumberToBytes(uint64(i), 32)), val)
@@ -206,35 +254,46 @@ func (block *Block) MakeContract(tx *Transaction) {
 
 /////// Block Encoding
 func (block *Block) Make() (interface{}, []string, interface{}) {
-	// Marshal the transactions of this block
+	encTx := block.encodedTransactions()
+	block.TxSha = ethutil.Sha3Bin([]byte(ethutil.Encode(encTx)))
+
+	uncles := block.encodedUncles()
+	// Sha of the concatenated uncles
+	block.UncleSha = ethutil.Sha3Bin(ethutil.Encode(uncles))
+
+	return block.header(), encTx, uncles
+}
+
+// Marshals the transactions of this block
+func (block *Block) encodedTransactions() []string {
 	encTx := make([]string, len(block.transactions))
 	for i, tx := range block.transactions {
 		// Cast it to a string (safe)
 		encTx[i] = string(tx.RlpEncode())
 	}
-	block.TxSha = ethutil.Sha3Bin([]byte(ethutil.Encode(encTx)))
 
+	return encTx
+}
+
+func (block *Block) encodedUncles() []interface{} {
 	uncles := make([]interface{}, len(block.Uncles))
 	for i, uncle := range block.Uncles {
-		uncles[i] = uncle.header()
+		uncles[i] = uncle.RlpData()
 	}
 
-	// Sha of the concatenated uncles
-	block.UncleSha = ethutil.Sha3Bin(ethutil.Encode(uncles))
-
-	return block.header(), encTx, uncles
+	return uncles
 }
 
 func (block *Block) SetTransactions(txs []*Transaction) {
 	block.transactions = txs
+	block.TxSha = ethutil.Sha3Bin([]byte(ethutil.Encode(block.encodedTransactions())))
+}
 
-	// Marshal the transactions of this block
-	encTx := make([]string, len(block.transactions))
-	for i, tx := range block.transactions {
-		// Cast it to a string (safe)
-		encTx[i] = string(tx.RlpEncode())
-	}
-	block.TxSha = ethutil.Sha3Bin([]byte(ethutil.Encode(encTx)))
+func (block *Block) SetUncles(uncles []*BlockHeader) {
+	block.Uncles = uncles
+
+	// Sha of the concatenated uncles
+	block.UncleSha = ethutil.Sha3Bin(ethutil.Encode(block.encodedUncles()))
 }
 
 func (block *Block) RlpValue() *ethutil.RlpValue {
@@ -244,6 +303,12 @@ func (block *Block) RlpValue() *ethutil.RlpValue {
 	return ethutil.NewRlpValue([]interface{}{header, encTx, uncles})
 }
 
+// Returns the length of the block's encoding. Unlike RlpEncode it leaves the
+// transaction and uncle hashes as the header declares them
+func (block *Block) size() int {
+	return len(ethutil.Encode([]interface{}{block.header(), block.encodedTransactions(), block.encodedUncles()}))
+}
+
 func (block *Block) RlpEncode() []byte {
 
 	// Encode a slice interface which contains the header and the list of
@@ -257,16 +322,17 @@ func (block *Block) RlpDecode(data []byte) {
 }
 
 func (block *Block) RlpValueDecode(decoder *ethutil.RlpValue) {
-	header := decoder.Get(0)
-
-	block.PrevHash = header.Get(0).AsBytes()
-	block.UncleSha = header.Get(1).AsBytes()
-	block.Coinbase = header.Get(2).AsBytes()
-	block.state = ethutil.NewTrie(ethutil.Config.Db, header.Get(3).AsRaw())
-	block.TxSha = header.Get(4).AsBytes()
-	block.Difficulty = header.Get(5).AsBigInt()
-	block.Time = int64(header.Get(6).AsUint())
-	block.Nonce = header.Get(7).AsBigInt()
+	header := NewBlockHeaderFromRlpValue(decoder.Get(0))
+
+	block.PrevHash = header.PrevHash
+	block.UncleSha = header.UncleSha
+	block.Coinbase = header.Coinbase
+	block.state = ethutil.NewTrie(block.db, header.Root)
+	block.TxSha = header.TxSha
+	block.Difficulty = header.Difficulty
+	block.Time = header.Time
+	block.Nonce = header.Nonce
+	block.Extra = header.Extra
 
 	// Tx list might be empty if this is an uncle. Uncles only have their
 	// header set.
@@ -277,23 +343,15 @@ func (block *Block) RlpValueDecode(decoder *ethutil.RlpValue) {
 			tx := &Transaction{}
 			tx.RlpDecode(txes.Get(i).AsBytes())
 			block.transactions[i] = tx
-
-			if ethutil.Config.Debug {
-				ethutil.Config.Db.Put(tx.Hash(), ethutil.Encode(tx))
-			}
 		}
 
 	}
 
 	if decoder.Get(2).IsNil() == false { // Yes explicitness
 		uncles := decoder.Get(2)
-		block.Uncles = make([]*Block, uncles.Length())
+		block.Uncles = make([]*BlockHeader, uncles.Length())
 		for i := 0; i < uncles.Length(); i++ {
-			block := &Block{}
-			// This is terrible but it's the way it has to be since
-			// I'm going by now means doing it by hand (the data is in it's raw format in interface form)
-			block.RlpDecode(ethutil.Encode(uncles.Get(i).AsRaw()))
-			block.Uncles[i] = block
+			block.Uncles[i] = NewBlockHeaderFromRlpValue(uncles.Get(i))
 		}
 	}
 
@@ -304,24 +362,6 @@ func (block *Block) String() string {
 }
 
 //////////// UNEXPORTED /////////////////
-func (block *Block) header() []interface{} {
-	return []interface{}{
-		// Sha of the previous block
-		block.PrevHash,
-		// Sha of uncles
-		block.UncleSha,
-		// Coinbase address
-		block.Coinbase,
-		// root state
-		block.state.Root,
-		// Sha of tx
-		block.TxSha,
-		// Current block Difficulty
-		block.Difficulty,
-		// Time the block was found?
-		uint64(block.Time),
-		// Block's Nonce for validation
-		block.Nonce,
-		block.Extra,
-	}
+func (block *Block) header() interface{} {
+	return block.Header().RlpData()
 }
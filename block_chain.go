@@ -4,13 +4,23 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/ethereum/ethutil-go"
+	"log"
 	"math"
 	"math/big"
+	"sync"
 )
 
 type BlockChain struct {
+	// Database the blocks, their state and the indexes are stored in
+	db Database
+
 	// The famous, the fabulous Mister GENESIIIIIIS (block)
 	genesisBlock *Block
+
+	// The head of the chain. Only changed by the block manager's import
+	// goroutine, other goroutines must use Head instead of reading these
+	// directly.
+	mutex sync.RWMutex
 	// Last known total difficulty
 	TD *big.Int
 
@@ -18,116 +28,391 @@ type BlockChain struct {
 
 	CurrentBlock  *Block
 	LastBlockHash []byte
+
+	// Difficulty adjustment used for creating and validating blocks
+	DiffCalc DifficultyCalculator
+	// Limits on the contents of blocks
+	Limits BlockLimits
+
+	// Reorganisations are posted here if set
+	events *EventMux
 }
 
-func NewBlockChain() *BlockChain {
-	bc := &BlockChain{}
-	bc.genesisBlock = NewBlockFromData(ethutil.Encode(Genesis))
+// Creates a new block chain stored in db. The genesis block is built from
+// the given specification or, if nil, from the test net's genesis.
+func NewBlockChain(db Database, genesis *Genesis) *BlockChain {
+	if genesis == nil {
+		genesis = DefaultGenesis()
+	}
+
+	bc := &BlockChain{db: db, DiffCalc: NewAdjustingDifficulty(), Limits: DefaultBlockLimits()}
+	bc.genesisBlock = genesis.Block(db)
 
 	// Set the last know difficulty (might be 0x0 as initial value, Genesis)
-	bc.TD = ethutil.BigD(ethutil.Config.Db.LastKnownTD())
+	bc.TD = ethutil.BigD(bc.db.LastKnownTD())
+
+	// Continue from the head of the last run if there is one
+	if hash, _ := bc.db.Get(headKey); len(hash) != 0 && bc.HasBlock(hash) {
+		bc.CurrentBlock = bc.GetBlock(hash)
+		bc.LastBlockHash = hash
+		bc.LastBlockNumber = bc.BlockInfoByHash(hash).Number
+		bc.TD = bc.GetTD(hash)
+	}
 
 	return bc
 }
 
+// Snapshot of the head of the chain
+type ChainHead struct {
+	// Copy of the head block with its own state trie. Changes to its state
+	// don't affect the chain
+	Block  *Block
+	Hash   []byte
+	Number uint64
+	TD     *big.Int
+}
+
+// Returns a snapshot of the head of the chain. Safe to call from any
+// goroutine. Block is nil if the chain has no blocks yet.
+func (bc *BlockChain) Head() ChainHead {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	head := ChainHead{Hash: bc.LastBlockHash, Number: bc.LastBlockNumber, TD: new(big.Int).Set(bc.TD)}
+	if bc.CurrentBlock != nil {
+		head.Block = bc.CurrentBlock.CopyWithState(bc.CurrentBlock.State().Root)
+	}
+
+	return head
+}
+
+// Creates a new block on top of the head. Transactions which would make the
+// block exceed the limits are left out. The transactions aren't applied to
+// the block's state, BlockManager.NewBlock does that.
 func (bc *BlockChain) NewBlock(coinbase []byte, txs []*Transaction) *Block {
 	var root interface{}
 	var hash []byte
-	var lastBlockTime int64
 
-	if bc.CurrentBlock != nil {
-		root = bc.CurrentBlock.State().Root
-		hash = bc.LastBlockHash
-		lastBlockTime = bc.CurrentBlock.Time
+	head := bc.Head()
+	if head.Block != nil {
+		root = head.Block.State().Root
+		hash = head.Hash
+	}
+
+	// The block without transactions tells how many of them fit
+	empty := CreateBlock(bc.db, root, hash, coinbase, ethutil.BigPow(2, 32), big.NewInt(0), "", nil)
+	if head.Block != nil {
+		empty.Difficulty = bc.DiffCalc.CalcDifficulty(head.Block.Header(), empty.Time)
+	}
+
+	fitted := bc.Limits.fitTransactions(txs, empty.size())
+	if len(fitted) < len(txs) {
+		log.Printf("[CHAIN] Left %d transaction(s) out of the new block\n", len(txs)-len(fitted))
 	}
 
 	block := CreateBlock(
+		bc.db,
 		root,
 		hash,
 		coinbase,
-		ethutil.BigPow(2, 32),
+		empty.Difficulty,
 		big.NewInt(0),
 		"",
-		txs)
-
-	if bc.CurrentBlock != nil {
-		var mul *big.Int
-		if block.Time < lastBlockTime+42 {
-			mul = big.NewInt(1)
-		} else {
-			mul = big.NewInt(-1)
-		}
-
-		diff := new(big.Int)
-		diff.Add(diff, bc.CurrentBlock.Difficulty)
-		diff.Div(diff, big.NewInt(1024))
-		diff.Mul(diff, mul)
-		diff.Add(diff, bc.CurrentBlock.Difficulty)
-		block.Difficulty = diff
-	}
+		fitted)
+	block.Time = empty.Time
 
 	return block
 }
 
 func (bc *BlockChain) HasBlock(hash []byte) bool {
-	data, _ := ethutil.Config.Db.Get(hash)
+	data, _ := bc.db.Get(hash)
 	return len(data) != 0
 }
 
+// Returns the database the chain is stored in
+func (bc *BlockChain) Database() Database {
+	return bc.db
+}
+
 func (bc *BlockChain) GenesisBlock() *Block {
 	return bc.genesisBlock
 }
 
-// Get chain return blocks from hash up to max in RLP format
+// Get chain return blocks from hash up to max in RLP format. The blocks are
+// ordered from newest to oldest and don't include the block of hash itself.
 func (bc *BlockChain) GetChainFromHash(hash []byte, max uint64) []interface{} {
-	var chain []interface{}
-	// Get the current hash to start with
-	currentHash := bc.CurrentBlock.Hash()
+	if !bc.HasBlock(hash) {
+		return nil
+	}
+
 	// Get the last number on the block chain
-	lastNumber := bc.BlockInfo(bc.CurrentBlock).Number
+	lastNumber := bc.Head().Number
 	// Get the parents number
 	parentNumber := bc.BlockInfoByHash(hash).Number
+	if parentNumber >= lastNumber {
+		return nil
+	}
 	// Get the min amount. We might not have max amount of blocks
 	count := uint64(math.Min(float64(lastNumber-parentNumber), float64(max)))
-	startNumber := parentNumber + count
 
-	num := lastNumber
-	for ; num > startNumber; currentHash = bc.GetBlock(currentHash).PrevHash {
-		num--
+	blocks, err := bc.GetBlocks(ChainQuery{Number: parentNumber + count, Max: count, Reverse: true})
+	if err != nil {
+		return nil
 	}
-	for i := uint64(0); bytes.Compare(currentHash, hash) != 0 && num > parentNumber && i < count; i++ {
-		// Get the block of the chain
-		block := bc.GetBlock(currentHash)
-		currentHash = block.PrevHash
-
-		chain = append(chain, block.RlpValue().Value)
 
-		num--
+	chain := make([]interface{}, len(blocks))
+	for i, block := range blocks {
+		chain[i] = block.RlpValue().Value
 	}
 
 	return chain
 }
 
-// Add a block to the chain and record addition information
-func (bc *BlockChain) Add(block *Block) {
-	bc.writeBlockInfo(block)
+// Describes a range of blocks to retrieve from the chain
+type ChainQuery struct {
+	// Hash of the first block. If nil the first block is taken from the
+	// canonical chain by Number
+	Hash   []byte
+	Number uint64
+	// Maximum amount of blocks to retrieve
+	Max uint64
+	// Amount of blocks skipped between two retrieved blocks
+	Skip uint64
+	// Walk towards the genesis instead of towards the head
+	Reverse bool
+}
+
+// Returns the hashes of the blocks described by the query. The starting block
+// must be known. Walking forward is only possible from a canonical block,
+// walking in reverse follows the parents of the starting block.
+func (bc *BlockChain) GetBlockHashes(query ChainQuery) ([][]byte, error) {
+	hash := query.Hash
+	number := query.Number
+	if hash == nil {
+		hash = bc.GetHashByNumber(number)
+		if hash == nil {
+			return nil, fmt.Errorf("Unknown block number %d", number)
+		}
+	} else {
+		if !bc.HasBlock(hash) {
+			return nil, fmt.Errorf("Unknown block %x", hash)
+		}
+		number = bc.BlockInfoByHash(hash).Number
+	}
+
+	canonical := bytes.Compare(bc.GetHashByNumber(number), hash) == 0
+	if !canonical && !query.Reverse {
+		return nil, fmt.Errorf("Block %x is not on the canonical chain", hash)
+	}
+
+	head := bc.Head().Number
+	step := query.Skip + 1
+	var hashes [][]byte
+	for uint64(len(hashes)) < query.Max {
+		hashes = append(hashes, hash)
+
+		if query.Reverse {
+			// The genesis block is number 1
+			if number <= step {
+				break
+			}
+			number -= step
+
+			if canonical {
+				hash = bc.GetHashByNumber(number)
+			} else {
+				for i := uint64(0); i < step; i++ {
+					hash = bc.GetHeader(hash).PrevHash
+				}
+				// Side chains eventually join the canonical chain
+				canonical = bytes.Compare(bc.GetHashByNumber(number), hash) == 0
+			}
+		} else {
+			number += step
+			if number > head {
+				break
+			}
+
+			// The chain might have been reorganised to a shorter one in
+			// the meantime
+			if hash = bc.GetHashByNumber(number); hash == nil {
+				break
+			}
+		}
+	}
+
+	return hashes, nil
+}
+
+// Returns the blocks described by the query
+func (bc *BlockChain) GetBlocks(query ChainQuery) ([]*Block, error) {
+	hashes, err := bc.GetBlockHashes(query)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*Block, len(hashes))
+	for i, hash := range hashes {
+		blocks[i] = bc.GetBlock(hash)
+	}
+
+	return blocks, nil
+}
+
+// Returns the headers of the blocks described by the query
+func (bc *BlockChain) GetHeaders(query ChainQuery) ([]*BlockHeader, error) {
+	hashes, err := bc.GetBlockHashes(query)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make([]*BlockHeader, len(hashes))
+	for i, hash := range hashes {
+		headers[i] = bc.GetHeader(hash)
+	}
+
+	return headers, nil
+}
+
+// Returns the hash of the canonical block with the given number or nil if
+// there's no such block
+func (bc *BlockChain) GetHashByNumber(number uint64) []byte {
+	data, _ := bc.db.Get(canonicalKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+
+	return data
+}
+
+// Returns the canonical block with the given number or nil if there's no
+// such block
+func (bc *BlockChain) GetBlockByNumber(number uint64) *Block {
+	hash := bc.GetHashByNumber(number)
+	if hash == nil {
+		return nil
+	}
+
+	return bc.GetBlock(hash)
+}
+
+func canonicalKey(number uint64) []byte {
+	return append([]byte("Canonical"), ethutil.NumberToBytes(number, 64)...)
+}
+
+// Add a block to the chain as the new head and record addition information.
+// Everything is committed at once.
+func (bc *BlockChain) Add(block *Block) error {
+	batch := newBatch(bc.db)
+	td := bc.GetTD(block.Hash())
+	number, reorg := bc.writeHead(batch, block, td)
+	if err := batch.Write(); err != nil {
+		return err
+	}
 
+	bc.setHead(block, number, td, reorg)
+
+	return nil
+}
+
+// Writes the block as the new head of the chain to batch and returns its
+// number. If the block doesn't extend the current head the canonical chain is
+// reorganised, the returned event describes the reorganisation.
+func (bc *BlockChain) writeHead(batch Batch, block *Block, td *big.Int) (uint64, *ReorgEvent) {
+	number := bc.writeBlock(batch, block)
+
+	var reorg *ReorgEvent
+	if bc.CurrentBlock != nil && bytes.Compare(block.PrevHash, bc.LastBlockHash) != 0 {
+		reorg = bc.reorg(batch, bc.CurrentBlock, block)
+	}
+
+	batch.Put(canonicalKey(number), block.Hash())
+	bc.writeTxLookups(batch, block, number)
+
+	batch.Put([]byte("LastKnownTotalDifficulty"), td.Bytes())
+	batch.Put(headKey, block.Hash())
+
+	return number, reorg
+}
+
+// Makes the block the head of the chain once it has been written
+func (bc *BlockChain) setHead(block *Block, number uint64, td *big.Int, reorg *ReorgEvent) {
 	// Prepare the genesis block
+	bc.mutex.Lock()
 	bc.CurrentBlock = block
 	bc.LastBlockHash = block.Hash()
+	bc.LastBlockNumber = number
+	bc.TD = td
+	bc.mutex.Unlock()
+
+	if reorg != nil && bc.events != nil {
+		bc.events.Post(*reorg)
+	}
+}
+
+// Moves the canonical chain from oldHead over to the chain of newHead. Blocks
+// which are no longer canonical are unindexed and the new chain, up to but
+// excluding newHead, is indexed.
+func (bc *BlockChain) reorg(batch Batch, oldHead, newHead *Block) *ReorgEvent {
+	oldBlock := oldHead
+	newBlock := bc.GetBlock(newHead.PrevHash)
+	oldNumber := bc.BlockInfo(oldBlock).Number
+	newNumber := bc.BlockInfo(newBlock).Number
 
-	ethutil.Config.Db.Put(block.Hash(), block.RlpEncode())
+	var oldChain, newChain []*Block
+	// Bring both chains to the same height
+	for ; oldNumber > newNumber; oldNumber-- {
+		oldChain = append(oldChain, oldBlock)
+		bc.deleteTxLookups(batch, oldBlock)
+		// Numbers past the new head are no longer part of the chain
+		if oldNumber > newNumber+1 {
+			batch.Delete(canonicalKey(oldNumber))
+		}
+		oldBlock = bc.GetBlock(oldBlock.PrevHash)
+	}
+	for ; newNumber > oldNumber; newNumber-- {
+		newChain = append(newChain, newBlock)
+		newBlock = bc.GetBlock(newBlock.PrevHash)
+	}
+
+	// Walk back until the common ancestor is found
+	for bytes.Compare(oldBlock.Hash(), newBlock.Hash()) != 0 {
+		oldChain = append(oldChain, oldBlock)
+		bc.deleteTxLookups(batch, oldBlock)
+		newChain = append(newChain, newBlock)
+
+		oldBlock = bc.GetBlock(oldBlock.PrevHash)
+		newBlock = bc.GetBlock(newBlock.PrevHash)
+	}
+
+	for i := len(newChain) - 1; i >= 0; i-- {
+		number := bc.BlockInfo(newChain[i]).Number
+		batch.Put(canonicalKey(number), newChain[i].Hash())
+		bc.writeTxLookups(batch, newChain[i], number)
+	}
+
+	log.Printf("[CHAIN] Reorganised chain at %x. %d new block(s)\n", oldBlock.Hash(), len(newChain)+1)
+
+	return &ReorgEvent{OldChain: oldChain, NewChain: append([]*Block{newHead}, newChain...)}
 }
 
 func (bc *BlockChain) GetBlock(hash []byte) *Block {
-	data, _ := ethutil.Config.Db.Get(hash)
+	data, _ := bc.db.Get(hash)
 
-	return NewBlockFromData(data)
+	return newBlockFromData(bc.db, data)
+}
+
+// Returns the header of the block with the given hash without decoding the
+// block's body
+func (bc *BlockChain) GetHeader(hash []byte) *BlockHeader {
+	data, _ := bc.db.Get(hash)
+
+	return NewBlockHeaderFromRlpValue(ethutil.NewRlpValueFromBytes(data).Get(0))
 }
 
 func (bc *BlockChain) BlockInfoByHash(hash []byte) BlockInfo {
 	bi := BlockInfo{}
-	data, _ := ethutil.Config.Db.Get(append(hash, []byte("Info")...))
+	data, _ := bc.db.Get(append(hash, []byte("Info")...))
 	bi.RlpDecode(data)
 
 	return bi
@@ -135,17 +420,57 @@ func (bc *BlockChain) BlockInfoByHash(hash []byte) BlockInfo {
 
 func (bc *BlockChain) BlockInfo(block *Block) BlockInfo {
 	bi := BlockInfo{}
-	data, _ := ethutil.Config.Db.Get(append(block.Hash(), []byte("Info")...))
+	data, _ := bc.db.Get(append(block.Hash(), []byte("Info")...))
 	bi.RlpDecode(data)
 
 	return bi
 }
 
+// Returns the total difficulty of the chain up to and including the block
+// with the given hash
+func (bc *BlockChain) GetTD(hash []byte) *big.Int {
+	data, _ := bc.db.Get(append(hash, []byte("TD")...))
+
+	return ethutil.BigD(data)
+}
+
+func (bc *BlockChain) writeTD(batch Batch, hash []byte, td *big.Int) {
+	batch.Put(append(hash, []byte("TD")...), td.Bytes())
+}
+
+// Stores the block and its info without changing the head of the chain.
+// Returns the block's number
+func (bc *BlockChain) writeBlock(batch Batch, block *Block) uint64 {
+	number := bc.writeBlockInfo(batch, block)
+
+	batch.Put(block.Hash(), block.RlpEncode())
+
+	return number
+}
+
+// Returns the receipts of the transactions in the block with the given hash
+func (bc *BlockChain) GetReceipts(hash []byte) Receipts {
+	data, _ := bc.db.Get(append(hash, []byte("Receipts")...))
+
+	return NewReceiptsFromData(data)
+}
+
+func (bc *BlockChain) writeReceipts(batch Batch, hash []byte, receipts Receipts) {
+	batch.Put(append(hash, []byte("Receipts")...), receipts.RlpEncode())
+}
+
 // Unexported method for writing extra non-essential block info to the db
-func (bc *BlockChain) writeBlockInfo(block *Block) {
-	bc.LastBlockNumber++
-	bi := BlockInfo{Number: bc.LastBlockNumber, Hash: block.Hash()}
+func (bc *BlockChain) writeBlockInfo(batch Batch, block *Block) uint64 {
+	// The number is one more than the parent's. Only the genesis doesn't
+	// have a parent
+	number := bc.LastBlockNumber + 1
+	if bc.HasBlock(block.PrevHash) {
+		number = bc.BlockInfoByHash(block.PrevHash).Number + 1
+	}
+	bi := BlockInfo{Number: number, Hash: block.Hash()}
 
 	// For now we use the block hash with the words "info" appended as key
-	ethutil.Config.Db.Put(append(block.Hash(), []byte("Info")...), bi.RlpEncode())
+	batch.Put(append(block.Hash(), []byte("Info")...), bi.RlpEncode())
+
+	return number
 }
@@ -0,0 +1,67 @@
+package ethchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetBlockHashes(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	chain := GenerateChain(genesis, 6, nil)
+	// Two blocks on top of #3 which don't outgrow the canonical chain
+	side := GenerateChain(chain[1], 2, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{1})
+	})
+	for _, block := range append(chain, side...) {
+		if _, err := bm.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Blocks by number, the genesis being #1
+	blocks := append([]*Block{genesis}, chain...)
+	tests := []struct {
+		query ChainQuery
+		exp   []*Block
+	}{
+		{ChainQuery{Number: 1, Max: 10}, blocks},
+		{ChainQuery{Number: 2, Max: 2}, blocks[1:3]},
+		{ChainQuery{Number: 1, Max: 10, Skip: 2}, []*Block{blocks[0], blocks[3], blocks[6]}},
+		{ChainQuery{Hash: chain[5].Hash(), Max: 10, Skip: 1, Reverse: true}, []*Block{blocks[6], blocks[4], blocks[2], blocks[0]}},
+		{ChainQuery{Number: 3, Max: 10, Reverse: true}, []*Block{blocks[2], blocks[1], blocks[0]}},
+		// Side chains are followed back until they join the canonical chain
+		{ChainQuery{Hash: side[1].Hash(), Max: 10, Reverse: true}, []*Block{side[1], side[0], blocks[2], blocks[1], blocks[0]}},
+		{ChainQuery{Hash: side[1].Hash(), Max: 10, Skip: 1, Reverse: true}, []*Block{side[1], blocks[2], blocks[0]}},
+	}
+	for i, test := range tests {
+		hashes, err := bm.bc.GetBlockHashes(test.query)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+
+		if len(hashes) != len(test.exp) {
+			t.Errorf("test %d: expected %d hashes, got %d", i, len(test.exp), len(hashes))
+			continue
+		}
+		for j, block := range test.exp {
+			if !bytes.Equal(hashes[j], block.Hash()) {
+				t.Errorf("test %d: hash %d: expected %x, got %x", i, j, block.Hash(), hashes[j])
+			}
+		}
+	}
+
+	for i, query := range []ChainQuery{
+		{Number: 8, Max: 1},
+		{Hash: []byte("unknown"), Max: 1},
+		// Walking forward only works on the canonical chain
+		{Hash: side[0].Hash(), Max: 2},
+	} {
+		if _, err := bm.bc.GetBlockHashes(query); err == nil {
+			t.Errorf("query %d: expected an error", i)
+		}
+	}
+}
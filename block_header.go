@@ -0,0 +1,171 @@
+package ethchain
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+	"time"
+)
+
+type BlockHeader struct {
+	// Hash to the previous block
+	PrevHash []byte
+	// Sha of the uncles
+	UncleSha []byte
+	// The coin base address
+	Coinbase []byte
+	// Root of the state trie
+	Root interface{}
+	// Sha of the transactions
+	TxSha []byte
+	// Difficulty for the block
+	Difficulty *big.Int
+	// Creation time
+	Time int64
+	// Block Nonce for verification
+	Nonce *big.Int
+	// Extra (unused)
+	Extra string
+}
+
+func NewBlockHeaderFromData(raw []byte) *BlockHeader {
+	header := &BlockHeader{}
+	header.RlpDecode(raw)
+
+	return header
+}
+
+func NewBlockHeaderFromRlpValue(rlpValue *ethutil.RlpValue) *BlockHeader {
+	header := &BlockHeader{}
+	header.RlpValueDecode(rlpValue)
+
+	return header
+}
+
+// Returns the hash of the full header, nonce included. This is the block's
+// identity used for storage and for linking blocks.
+func (h *BlockHeader) Hash() []byte {
+	return ethutil.Sha3Bin(h.RlpEncode())
+}
+
+// Returns the hash of the header without the nonce. This is the seal hash
+// the proof of work is searched and verified against.
+func (h *BlockHeader) HashNoNonce() []byte {
+	return ethutil.Sha3Bin(ethutil.Encode([]interface{}{h.PrevHash,
+		h.UncleSha, h.Coinbase, h.Root, h.TxSha, h.Difficulty, uint64(h.Time), h.Extra}))
+}
+
+func (h *BlockHeader) RlpData() interface{} {
+	return []interface{}{
+		// Sha of the previous block
+		h.PrevHash,
+		// Sha of uncles
+		h.UncleSha,
+		// Coinbase address
+		h.Coinbase,
+		// root state
+		h.Root,
+		// Sha of tx
+		h.TxSha,
+		// Current block Difficulty
+		h.Difficulty,
+		// Time the block was found?
+		uint64(h.Time),
+		// Block's Nonce for validation
+		h.Nonce,
+		h.Extra,
+	}
+}
+
+func (h *BlockHeader) RlpEncode() []byte {
+	return ethutil.Encode(h.RlpData())
+}
+
+func (h *BlockHeader) RlpDecode(data []byte) {
+	h.RlpValueDecode(ethutil.NewRlpValueFromBytes(data))
+}
+
+func (h *BlockHeader) RlpValueDecode(decoder *ethutil.RlpValue) {
+	h.PrevHash = decoder.Get(0).AsBytes()
+	h.UncleSha = decoder.Get(1).AsBytes()
+	h.Coinbase = decoder.Get(2).AsBytes()
+	h.Root = decoder.Get(3).AsRaw()
+	h.TxSha = decoder.Get(4).AsBytes()
+	h.Difficulty = decoder.Get(5).AsBigInt()
+	h.Time = int64(decoder.Get(6).AsUint())
+	h.Nonce = decoder.Get(7).AsBigInt()
+	h.Extra = decoder.Get(8).AsString()
+}
+
+func (h *BlockHeader) String() string {
+	return fmt.Sprintf("BlockHeader(%x):\nPrevHash:%x\nUncleSha:%x\nCoinbase:%x\nRoot:%x\nTxSha:%x\nDiff:%v\nTime:%d\nNonce:%d", h.Hash(), h.PrevHash, h.UncleSha, h.Coinbase, h.Root, h.TxSha, h.Difficulty, h.Time, h.Nonce)
+}
+
+// The header validator checks everything about a header that can be checked
+// without the block's body or state. This is used for block validation as
+// well as for uncles.
+type HeaderValidator struct {
+	Pow      PoW
+	DiffCalc DifficultyCalculator
+	// Local time source. Headers too far in the future are rejected
+	Clock Clock
+}
+
+func NewHeaderValidator(pow PoW, diffCalc DifficultyCalculator, clock Clock) *HeaderValidator {
+	return &HeaderValidator{Pow: pow, DiffCalc: diffCalc, Clock: clock}
+}
+
+// Validates header against its parent. Returns an error if the header is
+// invalid.
+// Validation validates easy over difficult (dagger takes longer time = difficult)
+func (v *HeaderValidator) ValidateHeader(header, parent *BlockHeader) error {
+	if bytes.Compare(header.PrevHash, parent.Hash()) != 0 {
+		return fmt.Errorf("%w %x (%x)", ErrInvalidParent, header.PrevHash, parent.Hash())
+	}
+
+	diff := header.Time - parent.Time
+	if diff < 0 {
+		return fmt.Errorf("%w: less then prev block %v", ErrInvalidTimestamp, diff)
+	}
+
+	// New blocks must be within the 15 minute range of the last block.
+	// Block times are in seconds
+	if diff > int64(15*time.Minute/time.Second) {
+		return fmt.Errorf("%w: too far in the future of last block (> 15 minutes)", ErrInvalidTimestamp)
+	}
+
+	// Nor may they be too far ahead of the local clock
+	if v.Clock != nil {
+		if ahead := header.Time - v.Clock.Now().Unix(); ahead > MaxFutureBlockTime {
+			return fmt.Errorf("%w: %d seconds ahead of the local clock", ErrFutureBlock, ahead)
+		}
+	}
+
+	// Check if the difficulty is what the parent and the timestamp imply
+	expDiff := v.DiffCalc.CalcDifficulty(parent, header.Time)
+	if header.Difficulty.Cmp(expDiff) != 0 {
+		return fmt.Errorf("%w %v (expected %v)", ErrInvalidDifficulty, header.Difficulty, expDiff)
+	}
+
+	// Verify the nonce of the block. Return an error if it's not valid
+	if !v.Pow.Verify(header.HashNoNonce(), header.Difficulty, header.Nonce) {
+		return ErrInvalidPoW
+	}
+
+	return nil
+}
+
+// Validates the block's body against the transaction and uncle hashes its
+// header declares. Returns an error if they don't match.
+func ValidateBody(block *Block) error {
+	if txSha := ethutil.Sha3Bin(ethutil.Encode(block.encodedTransactions())); bytes.Compare(txSha, block.TxSha) != 0 {
+		return fmt.Errorf("%w: transaction hash %x (expected %x)", ErrInvalidBody, block.TxSha, txSha)
+	}
+
+	if uncleSha := ethutil.Sha3Bin(ethutil.Encode(block.encodedUncles())); bytes.Compare(uncleSha, block.UncleSha) != 0 {
+		return fmt.Errorf("%w: uncle hash %x (expected %x)", ErrInvalidBody, block.UncleSha, uncleSha)
+	}
+
+	return nil
+}
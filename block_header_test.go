@@ -0,0 +1,57 @@
+package ethchain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestValidateBody(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	block := GenerateChain(genesis, 1, nil)[0]
+	if err := bm.ValidateBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bodies swapped without updating the header
+	txs := block.CopyWithState(block.State().Root)
+	txs.transactions = []*Transaction{NewTransaction(make([]byte, 20), big.NewInt(1), nil)}
+	if err := bm.ValidateBlock(txs); !errors.Is(err, ErrInvalidBody) {
+		t.Errorf("expected ErrInvalidBody for the transactions, got %v", err)
+	}
+
+	uncles := block.CopyWithState(block.State().Root)
+	uncles.Uncles = []*BlockHeader{genesis.Header()}
+	if err := bm.ValidateBlock(uncles); !errors.Is(err, ErrInvalidBody) {
+		t.Errorf("expected ErrInvalidBody for the uncles, got %v", err)
+	}
+}
+
+// A block whose header doesn't match its body is rejected before anything
+// of it is stored or its hashes are recomputed
+func TestProcessInvalidBody(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	block := GenerateChain(genesis, 1, nil)[0]
+	block.transactions = []*Transaction{NewTransaction(make([]byte, 20), big.NewInt(1), nil)}
+	hash := block.Hash()
+
+	if result, err := bm.ProcessBlock(block); result != Invalid || !errors.Is(err, ErrInvalidBody) {
+		t.Errorf("expected ErrInvalidBody, got %v (%v)", result, err)
+	}
+	if bm.bc.HasBlock(hash) {
+		t.Error("expected the block not to be stored")
+	}
+
+	// Not even as an orphan
+	orphan := GenerateChain(block, 1, nil)[0]
+	orphan.Uncles = []*BlockHeader{genesis.Header()}
+	if result, err := bm.ProcessBlock(orphan); result != Invalid || !errors.Is(err, ErrInvalidBody) {
+		t.Errorf("expected ErrInvalidBody, got %v (%v)", result, err)
+	}
+}
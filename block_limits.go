@@ -0,0 +1,65 @@
+package ethchain
+
+import (
+	"fmt"
+)
+
+// Consensus limits on the contents of a block. Blocks exceeding any of them
+// are invalid.
+type BlockLimits struct {
+	MaxTransactions int
+	MaxUncles       int
+	// Maximum size of the RLP encoded block in bytes
+	MaxSize int
+	// Maximum length of the extra data in bytes
+	MaxExtra int
+}
+
+func DefaultBlockLimits() BlockLimits {
+	return BlockLimits{
+		MaxTransactions: 1024,
+		MaxUncles:       4,
+		MaxSize:         1024 * 1024,
+		MaxExtra:        1024,
+	}
+}
+
+// Returns an error wrapping ErrBlockLimit if the block exceeds a limit. The
+// cheap checks come first so the encoding of a block with too many items is
+// never built. The block isn't changed, its header still has to be checked
+// against its body.
+func (l BlockLimits) Check(block *Block) error {
+	if len(block.Transactions()) > l.MaxTransactions {
+		return fmt.Errorf("%w: %d transactions (max %d)", ErrBlockLimit, len(block.Transactions()), l.MaxTransactions)
+	}
+
+	if len(block.Uncles) > l.MaxUncles {
+		return fmt.Errorf("%w: %d uncles (max %d)", ErrBlockLimit, len(block.Uncles), l.MaxUncles)
+	}
+
+	if len(block.Extra) > l.MaxExtra {
+		return fmt.Errorf("%w: %d bytes of extra data (max %d)", ErrBlockLimit, len(block.Extra), l.MaxExtra)
+	}
+
+	if size := block.size(); size > l.MaxSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrBlockLimit, size, l.MaxSize)
+	}
+
+	return nil
+}
+
+// Returns the leading transactions which fit in a block whose encoding
+// without transactions is baseSize bytes
+func (l BlockLimits) fitTransactions(txs []*Transaction, baseSize int) []*Transaction {
+	// Room for the length prefix of the transaction list
+	size := baseSize + 9
+	for i, tx := range txs {
+		// Every transaction is encoded as a string with its own length prefix
+		size += len(tx.RlpEncode()) + 9
+		if i >= l.MaxTransactions || size > l.MaxSize {
+			return txs[:i]
+		}
+	}
+
+	return txs
+}
@@ -0,0 +1,99 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Returns distinct transactions
+func newLimitTxs(n int) []*Transaction {
+	txs := make([]*Transaction, n)
+	for i := range txs {
+		txs[i] = newTestTx(uint64(i), ZeroHash160, 1)
+	}
+
+	return txs
+}
+
+func TestBlockLimits(t *testing.T) {
+	limits := BlockLimits{MaxTransactions: 2, MaxUncles: 1, MaxSize: 1024, MaxExtra: 4}
+	newBlock := func() *Block {
+		return CreateBlock(newSyncMemDatabase(), "", ZeroHash256, ZeroHash160, big.NewInt(1), big.NewInt(0), "", nil)
+	}
+
+	if err := limits.Check(newBlock()); err != nil {
+		t.Errorf("expected the empty block to pass, got %v", err)
+	}
+
+	txs := newBlock()
+	txs.SetTransactions(newLimitTxs(3))
+	uncles := newBlock()
+	uncles.SetUncles([]*BlockHeader{newBlock().Header(), newBlock().Header()})
+	extra := newBlock()
+	extra.Extra = "extra"
+	size := newBlock()
+	size.Extra = "data"
+	size.SetUncles([]*BlockHeader{newBlock().Header()})
+	size.Uncles[0].Extra = strings.Repeat("x", 1024)
+	for name, block := range map[string]*Block{"transactions": txs, "uncles": uncles, "extra": extra, "size": size} {
+		if err := limits.Check(block); !errors.Is(err, ErrBlockLimit) {
+			t.Errorf("%s: expected ErrBlockLimit, got %v", name, err)
+		}
+	}
+}
+
+// Checking the limits doesn't make a block whose body doesn't match its
+// header valid
+func TestBlockLimitsLeaveHeader(t *testing.T) {
+	block := CreateBlock(newSyncMemDatabase(), "", ZeroHash256, ZeroHash160, big.NewInt(1), big.NewInt(0), "", nil)
+	block.transactions = newLimitTxs(1)
+	hash := block.Hash()
+
+	if err := DefaultBlockLimits().Check(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.Hash(), hash) {
+		t.Error("expected the header to be left alone")
+	}
+	if err := ValidateBody(block); !errors.Is(err, ErrInvalidBody) {
+		t.Errorf("expected ErrInvalidBody, got %v", err)
+	}
+}
+
+func TestFitTransactions(t *testing.T) {
+	txs := newLimitTxs(10)
+	empty := CreateBlock(newSyncMemDatabase(), "", ZeroHash256, ZeroHash160, big.NewInt(1), big.NewInt(0), "", nil)
+	base := empty.size()
+
+	limits := DefaultBlockLimits()
+	if fitted := limits.fitTransactions(txs, base); len(fitted) != 10 {
+		t.Errorf("expected all transactions to fit, got %d", len(fitted))
+	}
+
+	limits.MaxTransactions = 3
+	if fitted := limits.fitTransactions(txs, base); len(fitted) != 3 {
+		t.Errorf("expected 3 transactions, got %d", len(fitted))
+	}
+
+	// Room for about four transactions
+	limits = DefaultBlockLimits()
+	limits.MaxSize = base + 4*len(txs[0].RlpEncode())
+	fitted := limits.fitTransactions(txs, base)
+	if len(fitted) == 0 || len(fitted) > 4 {
+		t.Fatalf("expected up to 4 transactions, got %d", len(fitted))
+	}
+	for i, tx := range fitted {
+		if tx != txs[i] {
+			t.Errorf("expected transaction %d to be kept in order", i)
+		}
+	}
+
+	// The estimate never exceeds the limit
+	block := CreateBlock(newSyncMemDatabase(), "", ZeroHash256, ZeroHash160, big.NewInt(1), big.NewInt(0), "", fitted)
+	if err := limits.Check(block); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,8 +2,6 @@ package ethchain
 
 import (
 	"bytes"
-	"encoding/hex"
-	"errors"
 	"fmt"
 	"github.com/ethereum/ethutil-go"
 	"github.com/ethereum/ethwire-go"
@@ -31,51 +29,76 @@ type BlockManager struct {
 
 	//CurrentBlock *Block
 
-	// Stack for processing contracts
-	stack *Stack
-	// non-persistent key/value memory storage
-	mem map[string]*big.Int
-
 	TransactionPool *TxPool
 
 	Pow PoW
 
 	Speaker PublicSpeaker
+
+	// Local time source used to judge block timestamps
+	Clock Clock
+	// Chain and transaction events are posted here
+	Events *EventMux
+	// Removes the state of old blocks if set
+	Pruner *StatePruner
+	// Blocks which are slightly ahead of the local clock
+	futureBlocks *futureBlocks
+	// Blocks whose parent is unknown
+	orphans *orphanBlocks
+	// Blocks waiting to be imported by the import goroutine
+	importQueue chan *blockImport
+	// Chain verifications waiting to run on the import goroutine
+	verifyQueue chan chan error
+
+	quit chan bool
 }
 
-func AddTestNetFunds(block *Block) {
-	for _, addr := range []string{
-		"812413ae7e515a3bcaf7b3444116527bce958c02", // Gavin
-		"93658b04240e4bd4046fd2d6d417d20f146f4b43", // Jeffrey
-	} {
-		log.Println("2^200 Wei to", addr)
-		codedAddr, _ := hex.DecodeString(addr)
-		addr := block.GetAddr(codedAddr)
-		addr.Amount = ethutil.BigPow(2, 32)
+// Maximum amount of blocks waiting to be imported
+const blockQueueSize = 256
 
-		block.UpdateAddr(codedAddr, addr)
-	}
+type blockImport struct {
+	block *Block
+	// Announce the block to the peers once imported
+	announce bool
+	// Receives the outcome of the import. Nil if nobody is waiting for it
+	done chan blockImportResult
+}
+
+type blockImportResult struct {
+	result ImportResult
+	err    error
 }
 
-func NewBlockManager(speaker PublicSpeaker) *BlockManager {
+func NewBlockManager(db Database, speaker PublicSpeaker, genesis *Genesis) *BlockManager {
 	bm := &BlockManager{
 		//server: s,
-		bc:      NewBlockChain(),
-		stack:   NewStack(),
-		mem:     make(map[string]*big.Int),
+		bc:      NewBlockChain(db, genesis),
 		Pow:     &EasyPow{},
 		Speaker: speaker,
+		Clock:   SystemClock{},
+		Events:  NewEventMux(),
+
+		futureBlocks: newFutureBlocks(),
+		orphans:      newOrphanBlocks(),
+		importQueue:  make(chan *blockImport, blockQueueSize),
+		verifyQueue:  make(chan chan error),
+		quit:         make(chan bool),
 	}
 
+	bm.bc.events = bm.Events
+
 	if bm.bc.CurrentBlock == nil {
-		AddTestNetFunds(bm.bc.genesisBlock)
 		// Prepare the genesis block
-		bm.bc.Add(bm.bc.genesisBlock)
+		if err := bm.bc.Add(bm.bc.genesisBlock); err != nil {
+			log.Panicln("[BMGR] Writing the genesis block failed:", err)
+		}
 
 		log.Printf("Genesis: %x\n", bm.bc.CurrentBlock.Hash())
 
 	}
 
+	go bm.importLoop()
+
 	return bm
 }
 
@@ -83,62 +106,356 @@ func (bm *BlockManager) BlockChain() *BlockChain {
 	return bm.bc
 }
 
-func (bm *BlockManager) ApplyTransactions(block *Block, txs []*Transaction) {
+// Starts processing the queued future blocks. Blocks are imported whether
+// started or not.
+func (bm *BlockManager) Start() {
+	go bm.futureHandler()
+}
+
+// Stops the import goroutine and the future block processing. Imports
+// afterwards fail with ErrStopped.
+func (bm *BlockManager) Stop() {
+	log.Println("[BMGR] Stopping...")
+
+	close(bm.quit)
+}
+
+// Blocks are imported one at a time by a single goroutine in the order they
+// were queued. Everything that changes the chain (the head, the indexes, the
+// orphan and future pools) happens on this goroutine. Other goroutines read
+// the head through BlockChain.Head and older states through StateAt.
+func (bm *BlockManager) importLoop() {
+out:
+	for {
+		select {
+		case task := <-bm.importQueue:
+			result, err := bm.importWithOrphans(task.block, task.announce)
+			if task.done != nil {
+				task.done <- blockImportResult{result, err}
+			} else if err != nil {
+				log.Printf("[BMGR] Queued block (%x) failed: %v\n", task.block.Hash(), err)
+			}
+		case done := <-bm.verifyQueue:
+			done <- bm.verifyChain()
+		case <-bm.quit:
+			break out
+		}
+	}
+}
+
+// Processes the block on the import goroutine. A panic caused by a malformed
+// block, like one with a transaction whose signature can't be recovered,
+// makes the block invalid instead of stopping the import goroutine. Nothing
+// of the block is committed in that case.
+func (bm *BlockManager) safeProcessBlock(block *Block, announce bool) (result ImportResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[BMGR] Processing block (%x) panicked: %v\n", block.Hash(), r)
+
+			result, err = Invalid, fmt.Errorf("%w: %v", ErrMalformedBlock, r)
+		}
+	}()
+
+	return bm.processBlock(block, announce)
+}
+
+// Processes the block followed by the orphans waiting on it and, in turn, on
+// them. The orphans are worked through in a list, a chain of orphans can be
+// as long as the orphan pool. Returns the outcome of the block itself.
+func (bm *BlockManager) importWithOrphans(block *Block, announce bool) (ImportResult, error) {
+	result, err := bm.safeProcessBlock(block, announce)
+	if err != nil || (result != Imported && result != SideChain) {
+		return result, err
+	}
+
+	parents := [][]byte{block.Hash()}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+
+		for _, orphan := range bm.orphans.take(parent) {
+			orphanResult, err := bm.safeProcessBlock(orphan, announce)
+			if err != nil {
+				log.Printf("[BMGR] Orphan block (%x) failed: %v\n", orphan.Hash(), err)
+
+				continue
+			}
+
+			if orphanResult == Imported || orphanResult == SideChain {
+				parents = append(parents, orphan.Hash())
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Queues the block for import and waits for the outcome. The result tells
+// what happened to a valid block. A non nil error means the block is invalid,
+// see errors.go. Safe to call from any goroutine.
+func (bm *BlockManager) ProcessBlock(block *Block) (ImportResult, error) {
+	return bm.importBlock(block, true)
+}
+
+// Like ProcessBlock but the block is only announced to the peers if announce
+// is set
+func (bm *BlockManager) importBlock(block *Block, announce bool) (ImportResult, error) {
+	done := make(chan blockImportResult, 1)
+	select {
+	case bm.importQueue <- &blockImport{block: block, announce: announce, done: done}:
+	case <-bm.quit:
+		return Invalid, ErrStopped
+	}
+
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-bm.quit:
+		return Invalid, ErrStopped
+	}
+}
+
+// Queues the block for import without waiting for the outcome. Invalid
+// blocks are logged. Blocks if the queue is full.
+func (bm *BlockManager) QueueBlock(block *Block) {
+	select {
+	case bm.importQueue <- &blockImport{block: block, announce: true}:
+	case <-bm.quit:
+	}
+}
+
+// Processes the queued future blocks every second
+func (bm *BlockManager) futureHandler() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			bm.ProcessFutureBlocks()
+		case <-bm.quit:
+			break out
+		}
+	}
+}
+
+// Processes the queued blocks whose time has come
+func (bm *BlockManager) ProcessFutureBlocks() {
+	for _, block := range bm.futureBlocks.due(bm.Clock.Now().Unix()) {
+		if _, err := bm.ProcessBlock(block); err != nil {
+			log.Printf("[BMGR] Queued future block (%x) failed: %v\n", block.Hash(), err)
+		}
+	}
+}
+
+// Applies the transactions to the state of block and returns a receipt for
+// each of them. Every transaction uses up its sender's nonce and is charged
+// its fee which goes to the block's coinbase. A transaction with the wrong
+// nonce or whose fee can't be paid is invalid, the returned error wraps
+// ErrInvalidTx and the receipts stop before it.
+func (bm *BlockManager) ApplyTransactions(block *Block, txs []*Transaction) (Receipts, error) {
+	receipts := make(Receipts, len(txs))
 	// Process each transaction/contract
-	for _, tx := range txs {
+	for i, tx := range txs {
+		receipt := &Receipt{TxHash: tx.Hash(), Fee: CalculateTxFee(tx), Status: ReceiptOk}
+
+		if err := useNonce(tx, block); err != nil {
+			return receipts[:i], fmt.Errorf("%w %x: %v", ErrInvalidTx, tx.Hash(), err)
+		}
+
+		if err := bm.TransactionPool.PayTxFee(tx, block, receipt.Fee); err != nil {
+			return receipts[:i], fmt.Errorf("%w %x: %v", ErrInvalidTx, tx.Hash(), err)
+		}
+
 		// If there's no recipient, it's a contract
 		if tx.IsContract() {
 			block.MakeContract(tx)
-			bm.ProcessContract(tx, block)
+			receipt.ContractAddress = tx.Hash()
+			if err := bm.ProcessContract(tx, block); err != nil {
+				receipt.Status = ReceiptVmError
+			}
 		} else {
-			bm.TransactionPool.ProcessTransaction(tx, block)
+			if err := bm.TransactionPool.ProcessTransaction(tx, block); err != nil {
+				receipt.Status = ReceiptFailed
+			}
 		}
+
+		// Record the intermediate state
+		receipt.PostState = block.State().Root
+		receipts[i] = receipt
+	}
+
+	return receipts, nil
+}
+
+// Creates a new block on top of the head with the transactions applied to
+// its state one at a time. Transactions which are invalid on top of the ones
+// before them, like replayed ones or ones whose nonce leaves a gap, are left
+// out just like those which would make the block exceed the limits. The
+// state lives in an overlay of the chain's database, importing the block
+// writes it.
+func (bm *BlockManager) NewBlock(coinbase []byte, txs []*Transaction) *Block {
+	block := bm.bc.NewBlock(coinbase, txs)
+	block = block.copyWithState(newBatch(bm.bc.db), block.State().Root)
+
+	var included []*Transaction
+	for _, tx := range block.Transactions() {
+		root := block.State().Root
+		if _, err := bm.ApplyTransactions(block, []*Transaction{tx}); err != nil {
+			// Back to the state before the transaction
+			block = block.CopyWithState(root)
+
+			if ethutil.Config.Debug {
+				log.Printf("[BMGR] Left transaction out of the new block: %v\n", err)
+			}
+
+			continue
+		}
+
+		included = append(included, tx)
 	}
+	block.SetTransactions(included)
+
+	return block
 }
 
-// Block processing and validating with a given (temporarily) state
-func (bm *BlockManager) ProcessBlock(block *Block) error {
+// Block processing and validating with a given (temporarily) state. Only
+// called on the import goroutine. The block becoming the head is broadcast
+// to the peers if announce is set.
+func (bm *BlockManager) processBlock(block *Block, announce bool) (ImportResult, error) {
+	// The chain keeps its own copy of the block. Its state lives in the
+	// chain's database whichever database it was decoded with
+	block = block.copyWithState(bm.bc.db, block.State().Root)
+
 	hash := block.Hash()
 	if bm.bc.HasBlock(hash) {
-		return nil
+		return Known, nil
 	}
 
 	if ethutil.Config.Debug {
 		log.Printf("[BMGR] Processing block(%x)\n", hash)
 	}
 
-	// Check if we have the parent hash, if it isn't known we discard it
-	// Reasons might be catching up or simply an invalid block
+	// Oversized blocks are rejected before they take up room in the orphan
+	// pool or the future queue
+	if err := bm.bc.Limits.Check(block); err != nil {
+		return Invalid, err
+	}
+
+	// The header must commit to the body before the block is kept around
+	if err := ValidateBody(block); err != nil {
+		return Invalid, err
+	}
+
+	// Check if we have the parent hash, if it isn't known the block is kept
+	// in the orphan pool until the parent arrives. Reasons might be catching
+	// up or a network race
 	if !bm.bc.HasBlock(block.PrevHash) && bm.bc.CurrentBlock != nil {
-		return fmt.Errorf("Block's parent unknown %x", block.PrevHash)
+		// Without the parent only the proof of work can be checked. Junk
+		// must not push real orphans out of the pool
+		if !bm.Pow.Verify(block.HashNoNonce(), block.Difficulty, block.Nonce) {
+			return Invalid, ErrInvalidPoW
+		}
+
+		bm.orphans.add(block, bm.Clock.Now().Unix())
+		bm.requestAncestors(block)
+
+		if ethutil.Config.Debug {
+			log.Printf("[BMGR] Block's parent unknown %x. Added to orphan pool\n", block.PrevHash)
+		}
+
+		return Orphan, nil
 	}
 
-	// Process the transactions on to current block
-	bm.ApplyTransactions(bm.bc.CurrentBlock, block.Transactions())
+	// Blocks slightly ahead of the local clock are held back until their
+	// time has come. Blocks further ahead are rejected by the validation
+	now := bm.Clock.Now().Unix()
+	if block.Time > now && block.Time <= now+MaxFutureBlockTime {
+		// Only blocks which are valid but for their time take up room in
+		// the queue
+		if err := bm.validateBlock(block, nil); err != nil {
+			return Invalid, err
+		}
+
+		if !bm.futureBlocks.add(block) {
+			return Future, ErrFutureQueueFull
+		}
+
+		if ethutil.Config.Debug {
+			log.Printf("[BMGR] Queued future block(%x) for %d seconds\n", hash, block.Time-now)
+		}
+
+		return Future, nil
+	}
 
 	// Block validation
 	if err := bm.ValidateBlock(block); err != nil {
-		return err
+		return Invalid, err
+	}
+
+	// Everything the block changes is collected in a batch and committed at
+	// once. The transactions are processed on a copy of the parent's state
+	// backed by the batch so an invalid block leaves no changes behind
+	batch := newBatch(bm.bc.db)
+	// Side chains forking off below the pruned blocks can't be processed
+	if _, err := bm.bc.StateAt(block.PrevHash); err != nil {
+		return Invalid, err
+	}
+	parent := bm.bc.GetBlock(block.PrevHash)
+	processor := block.copyWithState(batch, parent.State().Root)
+	receipts, err := bm.ApplyTransactions(processor, block.Transactions())
+	if err != nil {
+		return Invalid, err
 	}
 
 	/* TODO TESTNET HAS NO REWARDS
 	// I'm not sure, but I don't know if there should be thrown
 	// any errors at this time.
-	if err := bm.AccumelateRewards(block); err != nil {
-		return err
+	if err := bm.AccumelateRewards(processor, block); err != nil {
+		return Invalid, err
 	}
 	*/
 
+	// The resulting state must match the state root the block declares
+	if !block.State().Cmp(processor.State()) {
+		return Invalid, fmt.Errorf("%w %x (%x)", ErrInvalidStateRoot, block.State().Root, processor.State().Root)
+	}
+
 	// Calculate the new total difficulty and sync back to the db
-	if bm.CalculateTD(block) {
-		bm.bc.Add(block)
+	result := SideChain
+	td, isHead := bm.CalculateTD(block)
+	bm.bc.writeTD(batch, hash, td)
+
+	var number uint64
+	var reorg *ReorgEvent
+	if isHead {
+		number, reorg = bm.bc.writeHead(batch, block, td)
+	} else {
+		// Keep side chain blocks around. Their chain might outgrow the
+		// canonical chain later on
+		bm.bc.writeBlock(batch, block)
+	}
+	bm.bc.writeReceipts(batch, hash, receipts)
 
-		/*
-			ethutil.Config.Db.Put(block.Hash(), block.RlpEncode())
-			bm.bc.CurrentBlock = block
-			bm.LastBlockHash = block.Hash()
-			bm.writeBlockInfo(block)
-		*/
+	if err := batch.Write(); err != nil {
+		return Invalid, fmt.Errorf("Committing block %x failed: %v", hash, err)
+	}
+
+	if isHead {
+		// Encoding the block updates its hashes. It's done before the block
+		// becomes the head which other goroutines might be reading
+		encoded := block.RlpValue().Value
+
+		// Set the new total difficulty back to the block chain
+		bm.bc.setHead(block, number, td, reorg)
+		result = Imported
+
+		if bm.Pruner != nil && bm.Pruner.due(bm.bc.LastBlockNumber) {
+			if _, err := bm.Pruner.Prune(); err != nil {
+				log.Println("[BMGR] Pruning state failed:", err)
+			}
+		}
 
 		/*
 			txs := bm.TransactionPool.Flush()
@@ -152,7 +469,9 @@ func (bm *BlockManager) ProcessBlock(block *Block) error {
 		*/
 
 		// Broadcast the valid block back to the wire
-		bm.Speaker.Broadcast(ethwire.MsgBlockTy, []interface{}{block.RlpValue().Value})
+		if announce && bm.Speaker != nil {
+			bm.Speaker.Broadcast(ethwire.MsgBlockTy, []interface{}{encoded})
+		}
 		/*
 			if len(coded) != 0 {
 					bm.Speaker.Broadcast(ethwire.MsgTxTy, coded)
@@ -160,12 +479,44 @@ func (bm *BlockManager) ProcessBlock(block *Block) error {
 		*/
 	}
 
-	log.Printf("[BMGR] Added block (%x)\n", block.Hash())
+	log.Printf("[BMGR] Added block (%x) (%v)\n", hash, result)
 
-	return nil
+	bm.Events.Post(NewBlockEvent{Block: block, Result: result})
+	if result == Imported {
+		bm.Events.Post(ChainHeadEvent{Block: block})
+	} else {
+		bm.Events.Post(ChainSideEvent{Block: block})
+	}
+
+	return result, nil
 }
 
-func (bm *BlockManager) CalculateTD(block *Block) bool {
+// Asks the peers for the blocks missing between the current chain and the
+// given orphan. Peers answer a chain request with the blocks following the
+// first hash they know, so the request starts at the head whichever ancestor
+// is missing: the missing block's own hash is unknown here and asking from
+// it would skip the block itself. The missing ancestor only keeps the
+// request from being repeated while orphans sharing it keep arriving.
+func (bm *BlockManager) requestAncestors(orphan *Block) {
+	if bm.Speaker == nil {
+		return
+	}
+
+	missing := bm.orphans.ancestorToRequest(orphan, bm.Clock.Now().Unix())
+	if missing == nil {
+		return
+	}
+
+	if ethutil.Config.Debug {
+		log.Printf("[BMGR] Requesting ancestors of missing block %x\n", missing)
+	}
+
+	bm.Speaker.Broadcast(ethwire.MsgGetChainTy, []interface{}{bm.bc.CurrentBlock.Hash(), uint64(orphanBlocksLimit)})
+}
+
+// Calculates the total difficulty of the block and whether it's higher than
+// the total difficulty of the current chain
+func (bm *BlockManager) CalculateTD(block *Block) (*big.Int, bool) {
 	uncleDiff := new(big.Int)
 	for _, uncle := range block.Uncles {
 		uncleDiff = uncleDiff.Add(uncleDiff, uncle.Difficulty)
@@ -173,83 +524,75 @@ func (bm *BlockManager) CalculateTD(block *Block) bool {
 
 	// TD(genesis_block) = 0 and TD(B) = TD(B.parent) + sum(u.difficulty for u in B.uncles) + B.difficulty
 	td := new(big.Int)
-	td = td.Add(bm.bc.TD, uncleDiff)
+	td = td.Add(bm.bc.GetTD(block.PrevHash), uncleDiff)
 	td = td.Add(td, block.Difficulty)
 
-	// The new TD will only be accepted if the new difficulty is
-	// is greater than the previous.
-	if td.Cmp(bm.bc.TD) > 0 {
-		// Set the new total difficulty back to the block chain
-		bm.bc.TD = td
-
-		if ethutil.Config.Debug {
-			log.Println("[BMGR] TD(block) =", td)
-		}
-
-		return true
+	if ethutil.Config.Debug {
+		log.Println("[BMGR] TD(block) =", td)
 	}
 
-	return false
+	// The new TD will only be accepted if the new difficulty is
+	// is greater than the previous.
+	return td, td.Cmp(bm.bc.TD) > 0
 }
 
 // Validates the current block. Returns an error if the block was invalid,
 // an uncle or anything that isn't on the current block chain.
-// Validation validates easy over difficult (dagger takes longer time = difficult)
 func (bm *BlockManager) ValidateBlock(block *Block) error {
-	// TODO
-	// 2. Check if the difficulty is correct
+	return bm.validateBlock(block, bm.Clock)
+}
 
-	// Check each uncle's previous hash. In order for it to be valid
-	// is if it has the same block hash as the current
-	for _, uncle := range block.Uncles {
-		if bytes.Compare(uncle.PrevHash, block.PrevHash) != 0 {
-			return errors.New("Mismatching Prvhash from uncle")
-		}
+// Validates the block against the given clock. The timestamps aren't checked
+// against the local time if clock is nil
+func (bm *BlockManager) validateBlock(block *Block, clock Clock) error {
+	// The body is cheap to check, the header's proof of work isn't
+	if err := ValidateBody(block); err != nil {
+		return err
 	}
 
-	diff := block.Time - bm.bc.CurrentBlock.Time
-	if diff < 0 {
-		return fmt.Errorf("Block timestamp less then prev block %v", diff)
-	}
+	validator := NewHeaderValidator(bm.Pow, bm.bc.DiffCalc, clock)
 
-	// New blocks must be within the 15 minute range of the last block.
-	if diff > int64(15*time.Minute) {
-		return errors.New("Block is too far in the future of last block (> 15 minutes)")
+	parent := bm.bc.GetHeader(block.PrevHash)
+	if err := validator.ValidateHeader(block.Header(), parent); err != nil {
+		return err
 	}
 
-	// Verify the nonce of the block. Return an error if it's not valid
-	if !bm.Pow.Verify(block.Hash(), block.Difficulty, block.Nonce) {
-		return errors.New("Block's nonce is invalid")
-	}
+	// Check each uncle's previous hash. In order for it to be valid
+	// is if it has the same block hash as the current
+	for _, uncle := range block.Uncles {
+		if bytes.Compare(uncle.PrevHash, block.PrevHash) != 0 {
+			return fmt.Errorf("%w %x: mismatching Prvhash", ErrInvalidUncle, uncle.Hash())
+		}
 
-	if !block.State().Cmp(bm.bc.CurrentBlock.State()) {
-		//if block.State().Root != state.Root {
-		return fmt.Errorf("Invalid merkle root %x (%x)", block.State().Root, bm.bc.CurrentBlock.State().Root)
+		if err := validator.ValidateHeader(uncle, parent); err != nil {
+			return fmt.Errorf("%w %x: %v", ErrInvalidUncle, uncle.Hash(), err)
+		}
 	}
 
 	return nil
 }
 
-func (bm *BlockManager) AccumelateRewards(block *Block) error {
+func (bm *BlockManager) AccumelateRewards(processor *Block, block *Block) error {
 	// Get the coinbase rlp data
-	d := bm.bc.CurrentBlock.State().Get(string(block.Coinbase))
+	d := processor.State().Get(string(block.Coinbase))
 
 	ether := NewAddressFromData([]byte(d))
 
 	// Reward amount of ether to the coinbase address
 	ether.AddFee(CalculateBlockReward(block, len(block.Uncles)))
-	bm.bc.CurrentBlock.State().Update(string(block.Coinbase), string(ether.RlpEncode()))
+	processor.State().Update(string(block.Coinbase), string(ether.RlpEncode()))
 
 	// TODO Reward each uncle
 
 	return nil
 }
 
-func (bm *BlockManager) ProcessContract(tx *Transaction, block *Block) {
+func (bm *BlockManager) ProcessContract(tx *Transaction, block *Block) (err error) {
 	// Recovering function in case the VM had any errors
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Println("Recovered from VM execution with err =", r)
+			err = fmt.Errorf("VM execution failed: %v", r)
 		}
 	}()
 
@@ -262,10 +605,16 @@ func (bm *BlockManager) ProcessContract(tx *Transaction, block *Block) {
 
 		return true // Continue
 	})
+
+	return nil
 }
 
 // Contract evaluation is done here.
 func (bm *BlockManager) ProcContract(tx *Transaction, block *Block, cb TxCallback) {
+	// Every execution has its own stack and memory
+	stack := NewStack()
+	// non-persistent key/value memory storage
+	mem := make(map[string]*big.Int)
 
 	// Instruction pointer
 	pc := 0
@@ -305,34 +654,34 @@ out:
 		case oSTOP:
 			break out
 		case oADD:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// (x + y) % 2 ** 256
 			base.Add(x, y)
 			base.Mod(base, Pow256)
 			// Pop result back on the stack
-			bm.stack.Push(base)
+			stack.Push(base)
 		case oSUB:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// (x - y) % 2 ** 256
 			base.Sub(x, y)
 			base.Mod(base, Pow256)
 			// Pop result back on the stack
-			bm.stack.Push(base)
+			stack.Push(base)
 		case oMUL:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// (x * y) % 2 ** 256
 			base.Mul(x, y)
 			base.Mod(base, Pow256)
 			// Pop result back on the stack
-			bm.stack.Push(base)
+			stack.Push(base)
 		case oDIV:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// floor(x / y)
 			base.Div(x, y)
 			// Pop result back on the stack
-			bm.stack.Push(base)
+			stack.Push(base)
 		case oSDIV:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// n > 2**255
 			if x.Cmp(Pow256) > 0 {
 				x.Sub(Pow256, x)
@@ -346,13 +695,13 @@ out:
 				z.Sub(Pow256, z)
 			}
 			// Push result on to the stack
-			bm.stack.Push(z)
+			stack.Push(z)
 		case oMOD:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			base.Mod(x, y)
-			bm.stack.Push(base)
+			stack.Push(base)
 		case oSMOD:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// n > 2**255
 			if x.Cmp(Pow256) > 0 {
 				x.Sub(Pow256, x)
@@ -366,85 +715,85 @@ out:
 				z.Sub(Pow256, z)
 			}
 			// Push result on to the stack
-			bm.stack.Push(z)
+			stack.Push(z)
 		case oEXP:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			base.Exp(x, y, Pow256)
 
-			bm.stack.Push(base)
+			stack.Push(base)
 		case oNEG:
-			base.Sub(Pow256, bm.stack.Pop())
-			bm.stack.Push(base)
+			base.Sub(Pow256, stack.Pop())
+			stack.Push(base)
 		case oLT:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// x < y
 			if x.Cmp(y) < 0 {
-				bm.stack.Push(ethutil.BigTrue)
+				stack.Push(ethutil.BigTrue)
 			} else {
-				bm.stack.Push(ethutil.BigFalse)
+				stack.Push(ethutil.BigFalse)
 			}
 		case oLE:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// x <= y
 			if x.Cmp(y) < 1 {
-				bm.stack.Push(ethutil.BigTrue)
+				stack.Push(ethutil.BigTrue)
 			} else {
-				bm.stack.Push(ethutil.BigFalse)
+				stack.Push(ethutil.BigFalse)
 			}
 		case oGT:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// x > y
 			if x.Cmp(y) > 0 {
-				bm.stack.Push(ethutil.BigTrue)
+				stack.Push(ethutil.BigTrue)
 			} else {
-				bm.stack.Push(ethutil.BigFalse)
+				stack.Push(ethutil.BigFalse)
 			}
 		case oGE:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// x >= y
 			if x.Cmp(y) > -1 {
-				bm.stack.Push(ethutil.BigTrue)
+				stack.Push(ethutil.BigTrue)
 			} else {
-				bm.stack.Push(ethutil.BigFalse)
+				stack.Push(ethutil.BigFalse)
 			}
 		case oNOT:
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			// x != y
 			if x.Cmp(y) != 0 {
-				bm.stack.Push(ethutil.BigTrue)
+				stack.Push(ethutil.BigTrue)
 			} else {
-				bm.stack.Push(ethutil.BigFalse)
+				stack.Push(ethutil.BigFalse)
 			}
 
 		// Please note  that the  following code contains some
 		// ugly string casting. This will have to change to big
 		// ints. TODO :)
 		case oMYADDRESS:
-			bm.stack.Push(ethutil.BigD(tx.Hash()))
+			stack.Push(ethutil.BigD(tx.Hash()))
 		case oTXSENDER:
-			bm.stack.Push(ethutil.BigD(tx.Sender()))
+			stack.Push(ethutil.BigD(tx.Sender()))
 		case oTXVALUE:
-			bm.stack.Push(tx.Value)
+			stack.Push(tx.Value)
 		case oTXDATAN:
-			bm.stack.Push(big.NewInt(int64(len(tx.Data))))
+			stack.Push(big.NewInt(int64(len(tx.Data))))
 		case oTXDATA:
-			v := bm.stack.Pop()
+			v := stack.Pop()
 			// v >= len(data)
 			if v.Cmp(big.NewInt(int64(len(tx.Data)))) >= 0 {
-				bm.stack.Push(ethutil.Big("0"))
+				stack.Push(ethutil.Big("0"))
 			} else {
-				bm.stack.Push(ethutil.Big(tx.Data[v.Uint64()]))
+				stack.Push(ethutil.Big(tx.Data[v.Uint64()]))
 			}
 		case oBLK_PREVHASH:
-			bm.stack.Push(ethutil.BigD(block.PrevHash))
+			stack.Push(ethutil.BigD(block.PrevHash))
 		case oBLK_COINBASE:
-			bm.stack.Push(ethutil.BigD(block.Coinbase))
+			stack.Push(ethutil.BigD(block.Coinbase))
 		case oBLK_TIMESTAMP:
-			bm.stack.Push(big.NewInt(block.Time))
+			stack.Push(big.NewInt(block.Time))
 		case oBLK_NUMBER:
-			bm.stack.Push(big.NewInt(int64(blockInfo.Number)))
+			stack.Push(big.NewInt(int64(blockInfo.Number)))
 		case oBLK_DIFFICULTY:
-			bm.stack.Push(block.Difficulty)
+			stack.Push(block.Difficulty)
 		case oBASEFEE:
 			// e = 10^21
 			e := big.NewInt(0).Exp(big.NewInt(10), big.NewInt(21), big.NewInt(0))
@@ -461,30 +810,30 @@ out:
 			x.Div(e, base)
 
 			// x = floor(10^21 / floor(diff^0.5))
-			bm.stack.Push(x)
+			stack.Push(x)
 		case oSHA256, oSHA3, oRIPEMD160:
 			// This is probably save
 			// ceil(pop / 32)
-			length := int(math.Ceil(float64(bm.stack.Pop().Uint64()) / 32.0))
+			length := int(math.Ceil(float64(stack.Pop().Uint64()) / 32.0))
 			// New buffer which will contain the concatenated popped items
 			data := new(bytes.Buffer)
 			for i := 0; i < length; i++ {
 				// Encode the number to bytes and have it 32bytes long
-				num := ethutil.NumberToBytes(bm.stack.Pop().Bytes(), 256)
+				num := ethutil.NumberToBytes(stack.Pop().Bytes(), 256)
 				data.WriteString(string(num))
 			}
 
 			if op == oSHA256 {
-				bm.stack.Push(base.SetBytes(ethutil.Sha256Bin(data.Bytes())))
+				stack.Push(base.SetBytes(ethutil.Sha256Bin(data.Bytes())))
 			} else if op == oSHA3 {
-				bm.stack.Push(base.SetBytes(ethutil.Sha3Bin(data.Bytes())))
+				stack.Push(base.SetBytes(ethutil.Sha3Bin(data.Bytes())))
 			} else {
-				bm.stack.Push(base.SetBytes(ethutil.Ripemd160(data.Bytes())))
+				stack.Push(base.SetBytes(ethutil.Ripemd160(data.Bytes())))
 			}
 		case oECMUL:
-			y := bm.stack.Pop()
-			x := bm.stack.Pop()
-			//n := bm.stack.Pop()
+			y := stack.Pop()
+			x := stack.Pop()
+			//n := stack.Pop()
 
 			//if ethutil.Big(x).Cmp(ethutil.Big(y)) {
 			data := new(bytes.Buffer)
@@ -494,13 +843,13 @@ out:
 				// TODO
 			} else {
 				// Invalid, push infinity
-				bm.stack.Push(ethutil.Big("0"))
-				bm.stack.Push(ethutil.Big("0"))
+				stack.Push(ethutil.Big("0"))
+				stack.Push(ethutil.Big("0"))
 			}
 			//} else {
 			//	// Invalid, push infinity
-			//	bm.stack.Push("0")
-			//	bm.stack.Push("0")
+			//	stack.Push("0")
+			//	stack.Push("0")
 			//}
 
 		case oECADD:
@@ -509,73 +858,73 @@ out:
 		case oECVALID:
 		case oPUSH:
 			pc++
-			bm.stack.Push(bm.mem[strconv.Itoa(pc)])
+			stack.Push(mem[strconv.Itoa(pc)])
 		case oPOP:
 			// Pop current value of the stack
-			bm.stack.Pop()
+			stack.Pop()
 		case oDUP:
 			// Dup top stack
-			x := bm.stack.Pop()
-			bm.stack.Push(x)
-			bm.stack.Push(x)
+			x := stack.Pop()
+			stack.Push(x)
+			stack.Push(x)
 		case oSWAP:
 			// Swap two top most values
-			x, y := bm.stack.Popn()
-			bm.stack.Push(y)
-			bm.stack.Push(x)
+			x, y := stack.Popn()
+			stack.Push(y)
+			stack.Push(x)
 		case oMLOAD:
-			x := bm.stack.Pop()
-			bm.stack.Push(bm.mem[x.String()])
+			x := stack.Pop()
+			stack.Push(mem[x.String()])
 		case oMSTORE:
-			x, y := bm.stack.Popn()
-			bm.mem[x.String()] = y
+			x, y := stack.Popn()
+			mem[x.String()] = y
 		case oSLOAD:
 			// Load the value in storage and push it on the stack
-			x := bm.stack.Pop()
+			x := stack.Pop()
 			// decode the object as a big integer
 			decoder := ethutil.NewRlpValueFromBytes([]byte(contract.State().Get(x.String())))
 			if !decoder.IsNil() {
-				bm.stack.Push(decoder.AsBigInt())
+				stack.Push(decoder.AsBigInt())
 			} else {
-				bm.stack.Push(ethutil.BigFalse)
+				stack.Push(ethutil.BigFalse)
 			}
 		case oSSTORE:
 			// Store Y at index X
-			x, y := bm.stack.Popn()
+			x, y := stack.Popn()
 			contract.State().Update(x.String(), string(ethutil.Encode(y)))
 		case oJMP:
-			x := int(bm.stack.Pop().Uint64())
+			x := int(stack.Pop().Uint64())
 			// Set pc to x - 1 (minus one so the incrementing at the end won't effect it)
 			pc = x
 			pc--
 		case oJMPI:
-			x := bm.stack.Pop()
+			x := stack.Pop()
 			// Set pc to x if it's non zero
 			if x.Cmp(ethutil.BigFalse) != 0 {
 				pc = int(x.Uint64())
 				pc--
 			}
 		case oIND:
-			bm.stack.Push(big.NewInt(int64(pc)))
+			stack.Push(big.NewInt(int64(pc)))
 		case oEXTRO:
-			memAddr := bm.stack.Pop()
-			contractAddr := bm.stack.Pop().Bytes()
+			memAddr := stack.Pop()
+			contractAddr := stack.Pop().Bytes()
 
 			// Push the contract's memory on to the stack
-			bm.stack.Push(getContractMemory(block, contractAddr, memAddr))
+			stack.Push(getContractMemory(block, contractAddr, memAddr))
 		case oBALANCE:
 			// Pushes the balance of the popped value on to the stack
-			d := block.State().Get(bm.stack.Pop().String())
+			d := block.State().Get(stack.Pop().String())
 			ether := NewAddressFromData([]byte(d))
-			bm.stack.Push(ether.Amount)
+			stack.Push(ether.Amount)
 		case oMKTX:
-			value, addr := bm.stack.Popn()
-			from, length := bm.stack.Popn()
+			value, addr := stack.Popn()
+			from, length := stack.Popn()
 
 			j := 0
 			dataItems := make([]string, int(length.Uint64()))
 			for i := from.Uint64(); i < length.Uint64(); i++ {
-				dataItems[j] = string(bm.mem[strconv.Itoa(int(i))].Bytes())
+				dataItems[j] = string(mem[strconv.Itoa(int(i))].Bytes())
 				j++
 			}
 			// TODO sign it?
@@ -583,7 +932,7 @@ out:
 			// Add the transaction to the tx pool
 			bm.TransactionPool.QueueTransaction(tx)
 		case oSUICIDE:
-			//addr := bm.stack.Pop()
+			//addr := stack.Pop()
 		}
 		pc++
 	}
@@ -1,17 +1,33 @@
 package ethchain
 
 import (
-	_ "fmt"
+	"errors"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
 	"testing"
 )
 
 func TestVm(t *testing.T) {
+	// The fees are global, restore them for the other tests
+	fees := []*big.Int{StepFee, TxFee, ContractFee, MemFee, DataFee, CryptoFee, ExtroFee,
+		Period1Reward, Period2Reward, Period3Reward, Period4Reward}
+	saved := make([]*big.Int, len(fees))
+	for i, fee := range fees {
+		saved[i] = new(big.Int).Set(fee)
+	}
+	defer func() {
+		for i, fee := range fees {
+			fee.Set(saved[i])
+		}
+	}()
 	InitFees()
 
-	db, _ := NewMemDatabase()
-	Db = db
+	genesis := DefaultGenesis()
+	genesis.Alloc[string(testAddress())] = &GenesisAccount{Balance: ethutil.BigPow(2, 80)}
+	bm := newTestBlockManager(genesis)
+	defer bm.Stop()
 
-	ctrct := NewTransaction("", 200000000, []string{
+	ctrct := NewTransaction(nil, big.NewInt(200000000), []string{
 		"PUSH", "1a2f2e",
 		"PUSH", "hallo",
 		"POP", // POP hallo
@@ -63,11 +79,47 @@ func TestVm(t *testing.T) {
 
 		"STOP",
 	})
-	tx := NewTransaction("1e8a42ea8cce13", 100, []string{})
-
-	block := CreateBlock("", 0, "", "c014ba53", 0, 0, "", []*Transaction{ctrct, tx})
-	db.Put(block.Hash(), block.RlpEncode())
+	ctrct.Sign(testKey)
+	tx := newTestTx(1, []byte{0x1e, 0x8a, 0x42, 0xea, 0x8c, 0xce, 0x13}, 100)
+
+	block := GenerateChain(bm.bc.GenesisBlock(), 1, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{0xc0, 0x14, 0xba, 0x53})
+		gen.AddTx(ctrct)
+		gen.AddTx(tx)
+	})[0]
+	if result, err := bm.ProcessBlock(block); err != nil || result != Imported {
+		t.Fatalf("expected the block to be imported, got %v (%v)", result, err)
+	}
+
+	if bm.bc.CurrentBlock.GetContract(ctrct.Hash()) == nil {
+		t.Error("expected the contract to be created")
+	}
+	if receipts := bm.bc.GetReceipts(block.Hash()); len(receipts) != 2 || receipts[1].Status != ReceiptOk {
+		t.Errorf("expected the transfer to succeed, got %v", receipts)
+	}
+}
 
-	bm := NewBlockManager()
-	bm.ProcessBlock(block)
+// A block which makes processing panic is rejected and the blocks after it
+// are still imported
+func TestImportRecoversPanic(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	chain := GenerateChain(bm.bc.GenesisBlock(), 1, nil)
+	// The sender of a transaction without a signature can't be recovered
+	bad := GenerateChain(bm.bc.GenesisBlock(), 1, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{1})
+	})[0]
+	bad.SetTransactions([]*Transaction{NewTransaction(ZeroHash160, big.NewInt(1), nil)})
+
+	if result, err := bm.ProcessBlock(bad); result != Invalid || !errors.Is(err, ErrMalformedBlock) {
+		t.Errorf("expected ErrMalformedBlock, got %v (%v)", result, err)
+	}
+	if bm.bc.HasBlock(bad.Hash()) {
+		t.Error("expected the block not to be stored")
+	}
+
+	if result, err := bm.ProcessBlock(chain[0]); err != nil || result != Imported {
+		t.Errorf("expected the next block to be imported, got %v (%v)", result, err)
+	}
 }
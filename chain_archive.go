@@ -0,0 +1,124 @@
+package ethchain
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Writes the canonical blocks from up to and including to as a stream of RLP
+// encoded blocks
+func (bc *BlockChain) ExportChain(w io.Writer, from, to uint64) error {
+	for number := from; number <= to; number++ {
+		block := bc.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("Block #%d not found", number)
+		}
+
+		if _, err := w.Write(block.RlpEncode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads a stream of RLP encoded blocks and processes each of them. Imported
+// blocks aren't announced to the peers. Importing stops at the first block
+// which is invalid or can't be imported right away.
+func (bm *BlockManager) ImportChain(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for i := 1; ; i++ {
+		data, err := readRlpRecord(reader, uint64(bm.bc.Limits.MaxSize))
+		if err == io.EOF {
+			log.Printf("[BMGR] Imported %d block(s)\n", i-1)
+
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Reading block %d from archive: %v", i, err)
+		}
+
+		block := newBlockFromData(bm.bc.db, data)
+		// Archives usually start with blocks we already have (e.g. genesis)
+		if bm.bc.HasBlock(block.Hash()) {
+			continue
+		}
+
+		// Archives are ordered. A block with an unknown parent would
+		// otherwise end up in the orphan pool
+		if !bm.bc.HasBlock(block.PrevHash) {
+			return fmt.Errorf("Block %d in archive (%x): %w %x", i, block.Hash(), ErrUnknownParent, block.PrevHash)
+		}
+
+		result, err := bm.importBlock(block, false)
+		if err != nil {
+			return fmt.Errorf("Block #%d (%x) invalid: %w", bm.bc.BlockInfoByHash(block.PrevHash).Number+1, block.Hash(), err)
+		}
+		// Future blocks are only queued
+		if result != Imported && result != SideChain {
+			return fmt.Errorf("Block #%d (%x) not imported (%v)", bm.bc.BlockInfoByHash(block.PrevHash).Number+1, block.Hash(), result)
+		}
+
+		if i%1000 == 0 {
+			log.Printf("[BMGR] Imported %d blocks (head #%d)\n", i, bm.bc.Head().Number)
+		}
+	}
+}
+
+// Reads a single RLP item, including its prefix, from the reader. Items with
+// a payload larger than max bytes are an error
+func readRlpRecord(r *bufio.Reader, max uint64) ([]byte, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	record := []byte{prefix}
+
+	var size uint64
+	switch {
+	case prefix < 0x80:
+		return record, nil
+	case prefix < 0xb8:
+		size = uint64(prefix - 0x80)
+	case prefix < 0xc0:
+		record, size, err = readRlpLength(r, record, int(prefix-0xb7))
+	case prefix < 0xf8:
+		size = uint64(prefix - 0xc0)
+	default:
+		record, size, err = readRlpLength(r, record, int(prefix-0xf7))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size > max {
+		return nil, fmt.Errorf("RLP item of %d bytes exceeds the maximum of %d", size, max)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return append(record, payload...), nil
+}
+
+// Reads the big endian length of a long RLP item
+func readRlpLength(r *bufio.Reader, record []byte, n int) ([]byte, uint64, error) {
+	if n > 8 {
+		return nil, 0, fmt.Errorf("RLP length of %d bytes too large", n)
+	}
+
+	length := make([]byte, n)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	var size uint64
+	for _, b := range length {
+		size = size<<8 | uint64(b)
+	}
+
+	return append(record, length...), size, nil
+}
@@ -0,0 +1,125 @@
+package ethchain
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/ethereum/ethutil-go"
+	"github.com/ethereum/ethwire-go"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Records the types of the messages broadcast to the peers
+type testSpeaker struct {
+	mutex sync.Mutex
+	sent  []ethwire.MsgType
+}
+
+func (s *testSpeaker) Broadcast(msgType ethwire.MsgType, data []interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sent = append(s.sent, msgType)
+}
+
+// Returns how many messages of the type were broadcast
+func (s *testSpeaker) count(msgType ethwire.MsgType) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := 0
+	for _, sent := range s.sent {
+		if sent == msgType {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestReadRlpRecord(t *testing.T) {
+	records := [][]byte{
+		ethutil.Encode(uint64(1)),
+		ethutil.Encode("hello"),
+		ethutil.Encode([]interface{}{"a", "b", []interface{}{"c"}}),
+		ethutil.Encode([]interface{}{strings.Repeat("x", 100), strings.Repeat("y", 300)}),
+	}
+
+	var stream []byte
+	for _, record := range records {
+		stream = append(stream, record...)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(stream))
+	for i, exp := range records {
+		record, err := readRlpRecord(reader, 1024)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if bytes.Compare(record, exp) != 0 {
+			t.Errorf("record %d: expected %x, got %x", i, exp, record)
+		}
+	}
+
+	if _, err := readRlpRecord(reader, 1024); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	// A truncated record is an error
+	truncated := records[3][:len(records[3])-1]
+	if _, err := readRlpRecord(bufio.NewReader(bytes.NewReader(truncated)), 1024); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+
+	// So is a record larger than the maximum, whatever length it claims
+	for _, huge := range [][]byte{
+		records[3],
+		{0xbf, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := readRlpRecord(bufio.NewReader(bytes.NewReader(huge)), 300); err == nil {
+			t.Errorf("expected an error for %x", huge[:2])
+		}
+	}
+}
+
+func TestExportImportChain(t *testing.T) {
+	src := newTestBlockManager(nil)
+	defer src.Stop()
+
+	chain := GenerateChain(src.bc.GenesisBlock(), 5, nil)
+	for _, block := range chain {
+		if _, err := src.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := src.bc.ExportChain(&archive, 1, 6); err != nil {
+		t.Fatal(err)
+	}
+	// Followed by a block with the wrong difficulty
+	invalid := GenerateChain(chain[4], 1, nil)[0]
+	invalid.Difficulty = new(big.Int).Add(invalid.Difficulty, big.NewInt(1))
+	archive.Write(invalid.RlpEncode())
+
+	dst := newTestBlockManager(nil)
+	defer dst.Stop()
+	speaker := &testSpeaker{}
+	dst.Speaker = speaker
+
+	if err := dst.ImportChain(&archive); !errors.Is(err, ErrInvalidDifficulty) {
+		t.Errorf("expected ErrInvalidDifficulty, got %v", err)
+	}
+
+	head := dst.bc.Head()
+	if head.Number != 6 || !bytes.Equal(head.Hash, chain[4].Hash()) {
+		t.Errorf("expected head #6 (%x), got #%d (%x)", chain[4].Hash(), head.Number, head.Hash)
+	}
+	if n := speaker.count(ethwire.MsgBlockTy); n != 0 {
+		t.Errorf("expected imported blocks not to be broadcast, got %d", n)
+	}
+}
@@ -0,0 +1,137 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+	"log"
+)
+
+// Inconsistency found while verifying the chain
+type ChainError struct {
+	Number uint64
+	Hash   []byte
+	Err    error
+}
+
+func (err *ChainError) Error() string {
+	return fmt.Sprintf("Block #%d (%x): %v", err.Number, err.Hash, err.Err)
+}
+
+func (err *ChainError) Unwrap() error {
+	return err.Err
+}
+
+// Walks the canonical chain from the head back to the genesis block and
+// verifies the database is consistent. Returns a *ChainError describing the
+// first inconsistency found or nil if the chain is sound. Checked for every
+// block are:
+//
+//   - the block is stored under its hash and its parent is stored
+//   - its number is one less than its child's and it's the canonical block
+//     of that number
+//   - the proof of work
+//   - the transaction and uncle hashes against the body
+//   - the state root is in the database, unless it was pruned
+//
+// The check runs on the import goroutine so no block is imported or pruned
+// while it runs. Fails with ErrStopped if the block manager was stopped.
+func (bm *BlockManager) VerifyChain() error {
+	done := make(chan error, 1)
+	select {
+	case bm.verifyQueue <- done:
+	case <-bm.quit:
+		return ErrStopped
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-bm.quit:
+		return ErrStopped
+	}
+}
+
+func (bm *BlockManager) verifyChain() error {
+	bc := bm.bc
+
+	data, _ := bc.db.Get(prunedKey)
+	pruned := ethutil.BigD(data).Uint64()
+
+	head := bc.Head()
+	hash := head.Hash
+	number := head.Number
+	for {
+		if err := bm.verifyStoredBlock(hash, number, pruned); err != nil {
+			return &ChainError{Number: number, Hash: hash, Err: err}
+		}
+
+		if number == 1 {
+			break
+		}
+
+		hash = bc.GetHeader(hash).PrevHash
+		number--
+	}
+
+	log.Printf("[CHAIN] Verified %d block(s)\n", head.Number)
+
+	return nil
+}
+
+func (bm *BlockManager) verifyStoredBlock(hash []byte, number, pruned uint64) error {
+	bc := bm.bc
+
+	data, _ := bc.db.Get(hash)
+	if len(data) == 0 {
+		return errors.New("Block missing")
+	}
+
+	value := ethutil.NewRlpValueFromBytes(data)
+	header := NewBlockHeaderFromRlpValue(value.Get(0))
+	if !bytes.Equal(header.Hash(), hash) {
+		return errors.New("Stored block doesn't match its hash")
+	}
+
+	if info := bc.BlockInfoByHash(hash); info.Number != number {
+		return fmt.Errorf("Block info has number %d", info.Number)
+	}
+
+	if !bytes.Equal(bc.GetHashByNumber(number), hash) {
+		return errors.New("Block isn't indexed as canonical")
+	}
+
+	if txSha := ethutil.Sha3Bin(ethutil.Encode(value.Get(1).AsRaw())); !bytes.Equal(txSha, header.TxSha) {
+		return fmt.Errorf("Transaction hash mismatch (%x != %x)", txSha, header.TxSha)
+	}
+
+	if uncleSha := ethutil.Sha3Bin(ethutil.Encode(value.Get(2).AsRaw())); !bytes.Equal(uncleSha, header.UncleSha) {
+		return fmt.Errorf("Uncle hash mismatch (%x != %x)", uncleSha, header.UncleSha)
+	}
+
+	if number > pruned {
+		if _, err := loadNode(bc.db, header.Root); err != nil {
+			return fmt.Errorf("%w (%v)", ErrStatePruned, err)
+		}
+	}
+
+	// The genesis block has neither a parent nor a proof of work
+	if number == 1 {
+		if !bytes.Equal(hash, bc.genesisBlock.Hash()) {
+			return errors.New("Chain doesn't start at the genesis block")
+		}
+
+		return nil
+	}
+
+	if !bm.Pow.Verify(header.HashNoNonce(), header.Difficulty, header.Nonce) {
+		return ErrInvalidPoW
+	}
+
+	if !bc.HasBlock(header.PrevHash) {
+		return fmt.Errorf("%w: %x", ErrUnknownParent, header.PrevHash)
+	}
+
+	return nil
+}
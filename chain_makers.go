@@ -0,0 +1,114 @@
+package ethchain
+
+import (
+	"log"
+	"math/big"
+)
+
+// Proof of work which accepts every nonce. Plug it into a block manager to
+// import generated chains without mining them.
+type FakePow struct{}
+
+func (pow FakePow) Search(block *Block) *big.Int {
+	return big.NewInt(0)
+}
+
+func (pow FakePow) Verify(hash []byte, diff, nonce *big.Int) bool {
+	return true
+}
+
+// Seconds between generated blocks unless set otherwise
+const generatedBlockTime = 10
+
+// Builds one block of a generated chain
+type BlockGen struct {
+	parent *Block
+	block  *Block
+	// Used to apply the transactions
+	bm     *BlockManager
+	txs    []*Transaction
+	uncles []*BlockHeader
+}
+
+// Sets the coinbase of the block. The default is ZeroHash160. Panics once
+// transactions have been added, their fees went to the coinbase set before.
+func (gen *BlockGen) SetCoinbase(addr []byte) {
+	if len(gen.txs) != 0 {
+		log.Panicln("[CHAIN] Coinbase set after adding transactions")
+	}
+	gen.block.Coinbase = addr
+}
+
+// Sets the timestamp of the block. The default is generatedBlockTime seconds
+// after the parent
+func (gen *BlockGen) SetTime(time int64) {
+	gen.block.Time = time
+}
+
+func (gen *BlockGen) SetExtra(extra string) {
+	gen.block.Extra = extra
+}
+
+// Applies the transaction to the state of the block and includes it. The
+// transaction must be valid on top of the transactions added before.
+func (gen *BlockGen) AddTx(tx *Transaction) {
+	if _, err := gen.bm.ApplyTransactions(gen.block, []*Transaction{tx}); err != nil {
+		log.Panicln("[CHAIN] Generated transaction invalid:", err)
+	}
+	gen.txs = append(gen.txs, tx)
+}
+
+// Returns the nonce the next transaction sent from addr must have
+func (gen *BlockGen) TxNonce(addr []byte) uint64 {
+	return gen.block.GetAddr(addr).Nonce
+}
+
+// Includes the uncle. Uncles must be children of the block's parent
+func (gen *BlockGen) AddUncle(uncle *BlockHeader) {
+	gen.uncles = append(gen.uncles, uncle)
+}
+
+func (gen *BlockGen) Parent() *Block {
+	return gen.parent
+}
+
+// Returns the block as built so far. Its state reflects the transactions
+// added.
+func (gen *BlockGen) Block() *Block {
+	return gen.block
+}
+
+// Generates a chain of n blocks on top of parent. The blocks are linked and
+// valid for a block manager using FakePow and the default difficulty
+// adjustment. Each block is built by calling gen,
+// which may be nil, with its index and a BlockGen. The state of the blocks
+// lives in an overlay of the parent's database which is never written, the
+// parent's database is left untouched. The blocks aren't imported.
+func GenerateChain(parent *Block, n int, gen func(int, *BlockGen)) []*Block {
+	db := newBatch(parent.db)
+	bm := &BlockManager{
+		bc:              &BlockChain{db: db, DiffCalc: NewAdjustingDifficulty()},
+		TransactionPool: NewTxPool(),
+		Pow:             FakePow{},
+	}
+
+	blocks := make([]*Block, n)
+	for i := range blocks {
+		block := CreateBlock(db, parent.State().Root, parent.Hash(), ZeroHash160, nil, big.NewInt(0), "", nil)
+		block.Time = parent.Time + generatedBlockTime
+
+		g := &BlockGen{parent: parent, block: block, bm: bm}
+		if gen != nil {
+			gen(i, g)
+		}
+
+		block.SetTransactions(g.txs)
+		block.SetUncles(g.uncles)
+		block.Difficulty = bm.bc.DiffCalc.CalcDifficulty(parent.Header(), block.Time)
+
+		blocks[i] = block
+		parent = block
+	}
+
+	return blocks
+}
@@ -0,0 +1,81 @@
+package ethchain
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestGenerateChain(t *testing.T) {
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+	db := bm.bc.db.(*syncMemDatabase)
+	size := len(db.db)
+
+	to := make([]byte, 20)
+	to[0] = 1
+	genesis := bm.bc.GenesisBlock()
+	chain := GenerateChain(genesis, 3, func(i int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{2})
+		for j := 0; j <= i; j++ {
+			gen.AddTx(newTestTx(gen.TxNonce(testAddress()), to, 1))
+		}
+
+		// A sibling of the parent as uncle
+		if i == 2 {
+			uncle := GenerateChain(gen.Parent(), 1, func(_ int, gen *BlockGen) {
+				gen.SetExtra("uncle")
+			})[0]
+			gen.AddUncle(uncle.Header())
+		}
+	})
+
+	// Generating leaves the chain's database alone
+	if len(db.db) != size {
+		t.Errorf("expected %d keys in the database, got %d", size, len(db.db))
+	}
+
+	if !bytes.Equal(chain[0].PrevHash, genesis.Hash()) {
+		t.Error("expected the first block to be a child of the genesis")
+	}
+	for i, block := range chain {
+		if block.Time != int64(10*(i+1)) {
+			t.Errorf("block %d: expected time %d, got %d", i, 10*(i+1), block.Time)
+		}
+		if len(block.Transactions()) != i+1 {
+			t.Errorf("block %d: expected %d transactions, got %d", i, i+1, len(block.Transactions()))
+		}
+	}
+	if len(chain[2].Uncles) != 1 {
+		t.Errorf("expected 1 uncle, got %d", len(chain[2].Uncles))
+	}
+
+	for _, block := range chain {
+		if result, err := bm.ProcessBlock(block); err != nil || result != Imported {
+			t.Fatalf("expected the block to be imported, got %v (%v)", result, err)
+		}
+	}
+
+	head := bm.bc.CurrentBlock
+	if balance := head.GetAddr(to).Amount; balance.Cmp(big.NewInt(6)) != 0 {
+		t.Errorf("expected a balance of 6, got %v", balance)
+	}
+	if nonce := head.GetAddr(testAddress()).Nonce; nonce != 6 {
+		t.Errorf("expected nonce 6, got %d", nonce)
+	}
+}
+
+func TestGenerateCoinbaseAfterTx(t *testing.T) {
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected setting the coinbase after a transaction to panic")
+		}
+	}()
+	GenerateChain(bm.bc.GenesisBlock(), 1, func(_ int, gen *BlockGen) {
+		gen.AddTx(newTestTx(0, ZeroHash160, 1))
+		gen.SetCoinbase([]byte{1})
+	})
+}
@@ -0,0 +1,89 @@
+package ethchain
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentImports(t *testing.T) {
+	bm := NewBlockManager(newSyncMemDatabase(), nil, nil)
+	bm.Pow = FakePow{}
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	var chains [][]*Block
+	for i, n := range []int{20, 20, 25} {
+		coinbase := []byte{byte(i + 1)}
+		chains = append(chains, GenerateChain(genesis, n, func(_ int, gen *BlockGen) {
+			gen.SetCoinbase(coinbase)
+		}))
+	}
+
+	done := make(chan bool)
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				head := bm.bc.Head()
+				head.Block.GetAddr([]byte{1})
+				if _, err := bm.bc.StateAt(head.Hash); err != nil {
+					t.Error(err)
+				}
+				bm.bc.GetBlockHashes(ChainQuery{Number: 1, Max: 10})
+				bm.bc.NewBlock([]byte{4}, nil)
+			}
+		}()
+	}
+
+	// Verifying the chain while blocks are imported finds nothing wrong
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if err := bm.VerifyChain(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	var importers sync.WaitGroup
+	for _, chain := range chains {
+		importers.Add(1)
+		go func(chain []*Block) {
+			defer importers.Done()
+			for _, block := range chain {
+				if _, err := bm.ProcessBlock(block); err != nil {
+					t.Error(err)
+				}
+			}
+		}(chain)
+	}
+
+	importers.Wait()
+	close(done)
+	readers.Wait()
+
+	head := bm.bc.Head()
+	if head.Number != 26 || !bytes.Equal(head.Hash, chains[2][24].Hash()) {
+		t.Errorf("expected head #26 (%x), got #%d (%x)", chains[2][24].Hash(), head.Number, head.Hash)
+	}
+
+	if err := bm.VerifyChain(); err != nil {
+		t.Error(err)
+	}
+}
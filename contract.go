@@ -9,11 +9,22 @@ type Contract struct {
 	Amount *big.Int
 	Nonce  uint64
 	state  *ethutil.Trie
+	// Database the storage lives in
+	db Database
 }
 
-func NewContract(Amount *big.Int, root []byte) *Contract {
-	contract := &Contract{Amount: Amount, Nonce: 0}
-	contract.state = ethutil.NewTrie(ethutil.Config.Db, string(root))
+// Creates a contract whose storage lives in db
+func NewContract(db Database, Amount *big.Int, root []byte) *Contract {
+	contract := &Contract{Amount: Amount, Nonce: 0, db: db}
+	contract.state = ethutil.NewTrie(db, string(root))
+
+	return contract
+}
+
+// Decodes a contract whose storage lives in db
+func newContractFromData(db Database, data []byte) *Contract {
+	contract := &Contract{db: db}
+	contract.RlpDecode(data)
 
 	return contract
 }
@@ -27,7 +38,7 @@ func (c *Contract) RlpDecode(data []byte) {
 
 	c.Amount = decoder.Get(0).AsBigInt()
 	c.Nonce = decoder.Get(1).AsUint()
-	c.state = ethutil.NewTrie(ethutil.Config.Db, decoder.Get(2).AsRaw())
+	c.state = ethutil.NewTrie(c.db, decoder.Get(2).AsRaw())
 }
 
 func (c *Contract) State() *ethutil.Trie {
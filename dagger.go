@@ -22,7 +22,7 @@ type EasyPow struct {
 func (pow *EasyPow) Search(block *Block) *big.Int {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	hash := block.Hash()
+	hash := block.HashNoNonce()
 	diff := block.Difficulty
 	for {
 		rnd := big.NewInt(r.Int63())
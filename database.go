@@ -0,0 +1,116 @@
+package ethchain
+
+import (
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+)
+
+// The database a chain is stored in. Blocks are committed in atomic batches,
+// importing fails unless the database implements BatchDatabase as
+// LDBDatabase does. Deleting keys is used if the database supports it, see
+// keyDeleter.
+type Database interface {
+	ethutil.Database
+}
+
+// Key of the hash of the head block
+var headKey = []byte("LastBlock")
+
+// Implemented by databases which support deletion
+type keyDeleter interface {
+	Delete(key []byte) error
+}
+
+// Writes collected in a batch are committed together by Write
+type Batch interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+	Write() error
+}
+
+// Implemented by databases which can commit a batch of writes atomically
+type BatchDatabase interface {
+	NewBatch() Batch
+}
+
+type batchOp struct {
+	key   []byte
+	value []byte
+	// Delete the key instead of putting value
+	delete bool
+}
+
+// A batch collecting writes in memory until they're committed to the
+// database. Reads through the batch see its pending writes, which makes it
+// usable as the database of a state trie whose changes should only be
+// committed together with the block.
+//
+// The writes are committed atomically, which requires the database to
+// implement BatchDatabase. Writing them one by one could leave the canonical
+// index disagreeing with the head pointer after a crash.
+type memBatch struct {
+	db  Database
+	ops []batchOp
+	// Pending values by key. Deleted keys map to nil
+	pending map[string][]byte
+}
+
+func newBatch(db Database) *memBatch {
+	return &memBatch{db: db, pending: make(map[string][]byte)}
+}
+
+func (b *memBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+	b.pending[string(key)] = value
+}
+
+func (b *memBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+	b.pending[string(key)] = nil
+}
+
+func (b *memBatch) Get(key []byte) ([]byte, error) {
+	if value, ok := b.pending[string(key)]; ok {
+		return value, nil
+	}
+
+	return b.db.Get(key)
+}
+
+func (b *memBatch) LastKnownTD() []byte {
+	data, _ := b.Get([]byte("LastKnownTotalDifficulty"))
+
+	return data
+}
+
+func (b *memBatch) Close() {}
+
+func (b *memBatch) Print() {
+	b.db.Print()
+}
+
+// Commits the pending writes to the database at once and empties the batch.
+// Nothing is written if it fails
+func (b *memBatch) Write() error {
+	db, ok := b.db.(BatchDatabase)
+	if !ok {
+		return fmt.Errorf("Database %T doesn't support atomic batches", b.db)
+	}
+
+	batch := db.NewBatch()
+	for _, op := range b.ops {
+		if op.delete {
+			batch.Delete(op.key)
+		} else {
+			batch.Put(op.key, op.value)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	b.ops = nil
+	b.pending = make(map[string][]byte)
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+// Memory database which can be used from several goroutines and commits
+// batches atomically
+type syncMemDatabase struct {
+	mutex sync.RWMutex
+	db    map[string][]byte
+	// Batches fail after writing this many keys if set
+	failAfter int
+}
+
+func newSyncMemDatabase() *syncMemDatabase {
+	return &syncMemDatabase{db: make(map[string][]byte)}
+}
+
+func (db *syncMemDatabase) Put(key []byte, value []byte) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.db[string(key)] = value
+}
+
+func (db *syncMemDatabase) Get(key []byte) ([]byte, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.db[string(key)], nil
+}
+
+func (db *syncMemDatabase) Delete(key []byte) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	delete(db.db, string(key))
+
+	return nil
+}
+
+func (db *syncMemDatabase) LastKnownTD() []byte {
+	data, _ := db.Get([]byte("LastKnownTotalDifficulty"))
+
+	return data
+}
+
+func (db *syncMemDatabase) NewBatch() Batch {
+	return &syncMemBatch{db: db}
+}
+
+func (db *syncMemDatabase) Close() {}
+func (db *syncMemDatabase) Print() {}
+
+type syncMemBatch struct {
+	db  *syncMemDatabase
+	ops []batchOp
+}
+
+func (b *syncMemBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+}
+
+func (b *syncMemBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+}
+
+// The writes go to a copy of the database which replaces it once all of them
+// succeeded
+func (b *syncMemBatch) Write() error {
+	b.db.mutex.Lock()
+	defer b.db.mutex.Unlock()
+
+	db := make(map[string][]byte, len(b.db.db))
+	for key, value := range b.db.db {
+		db[key] = value
+	}
+
+	for i, op := range b.ops {
+		if b.db.failAfter != 0 && i == b.db.failAfter {
+			return errors.New("Disk full")
+		}
+
+		if op.delete {
+			delete(db, string(op.key))
+		} else {
+			db[string(op.key)] = op.value
+		}
+	}
+	b.db.db = db
+
+	return nil
+}
+
+// Returns a block manager on a fresh memory database which accepts any proof
+// of work. Stop it when done
+func newTestBlockManager(genesis *Genesis) *BlockManager {
+	bm := NewBlockManager(newSyncMemDatabase(), nil, genesis)
+	bm.Pow = FakePow{}
+
+	return bm
+}
+
+// Private key of the account funded by newTestGenesis
+var testKey = []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+// Returns a transaction sent from testKey's account
+func newTestTx(nonce uint64, to []byte, value int64) *Transaction {
+	tx := NewTransaction(to, big.NewInt(value), nil)
+	tx.Nonce = nonce
+	tx.Sign(testKey)
+
+	return tx
+}
+
+// Returns the address of testKey's account
+func testAddress() []byte {
+	return newTestTx(0, ZeroHash160, 0).Sender()
+}
+
+// Returns the default genesis with testKey's account funded
+func newTestGenesis() *Genesis {
+	genesis := DefaultGenesis()
+	genesis.Alloc[string(testAddress())] = &GenesisAccount{Balance: ethutil.BigPow(2, 64)}
+
+	return genesis
+}
+
+func TestBatchRequiresBatchDatabase(t *testing.T) {
+	db, _ := ethutil.NewMemDatabase()
+
+	batch := newBatch(db)
+	batch.Put([]byte("key"), []byte("value"))
+	if err := batch.Write(); err == nil {
+		t.Error("expected an error writing to a database without batches")
+	}
+	if data, _ := db.Get([]byte("key")); len(data) != 0 {
+		t.Error("expected nothing to be written")
+	}
+}
+
+// A block whose commit fails halfway through a reorganisation must leave
+// the database as it was
+func TestFailedCommitDuringReorg(t *testing.T) {
+	db := newSyncMemDatabase()
+	bm := NewBlockManager(db, nil, nil)
+	bm.Pow = FakePow{}
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	canonical := GenerateChain(genesis, 3, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{1})
+	})
+	fork := GenerateChain(genesis, 4, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{2})
+	})
+	for _, block := range append(canonical, fork[:3]...) {
+		if _, err := bm.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.failAfter = 5
+	if _, err := bm.ProcessBlock(fork[3]); err == nil {
+		t.Fatal("expected the commit to fail")
+	}
+
+	head := canonical[2].Hash()
+	if !bytes.Equal(bm.bc.Head().Hash, head) {
+		t.Errorf("expected head %x, got %x", head, bm.bc.Head().Hash)
+	}
+	for i, block := range canonical {
+		if hash := bm.bc.GetHashByNumber(uint64(i + 2)); !bytes.Equal(hash, block.Hash()) {
+			t.Errorf("block #%d: expected %x to be canonical, got %x", i+2, block.Hash(), hash)
+		}
+	}
+	if bm.bc.HasBlock(fork[3].Hash()) {
+		t.Error("expected the failed block not to be stored")
+	}
+	if err := bm.VerifyChain(); err != nil {
+		t.Error(err)
+	}
+
+	// A restart resumes from the same head
+	if bc := NewBlockChain(db, nil); !bytes.Equal(bc.LastBlockHash, head) || bc.LastBlockNumber != 4 {
+		t.Errorf("expected to resume from #4 (%x), got #%d (%x)", head, bc.LastBlockNumber, bc.LastBlockHash)
+	}
+
+	// Once the database works again the fork takes over
+	db.failAfter = 0
+	if result, err := bm.ProcessBlock(fork[3]); err != nil || result != Imported {
+		t.Fatalf("expected the block to be imported, got %v (%v)", result, err)
+	}
+	if !bytes.Equal(bm.bc.GetHashByNumber(2), fork[0].Hash()) {
+		t.Error("expected the fork to be canonical")
+	}
+}
+
+// Two chains in one process each keep to their own database
+func TestSeparateDatabases(t *testing.T) {
+	first := newTestBlockManager(newTestGenesis())
+	defer first.Stop()
+	second := newTestBlockManager(newTestGenesis())
+	defer second.Stop()
+
+	to := make([]byte, 20)
+	to[0] = 1
+	chain := GenerateChain(first.bc.GenesisBlock(), 3, func(i int, gen *BlockGen) {
+		gen.AddTx(newTestTx(gen.TxNonce(testAddress()), to, 1))
+	})
+
+	// Both import the blocks as they arrive from peers, the second one
+	// misses the last block
+	for i, block := range chain {
+		if _, err := first.ProcessBlock(NewBlockFromData(block.RlpEncode())); err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 {
+			break
+		}
+		if _, err := second.ProcessBlock(NewBlockFromData(block.RlpEncode())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		bm      *BlockManager
+		number  uint64
+		balance int64
+	}{{first, 4, 3}, {second, 3, 2}} {
+		head := test.bm.bc.CurrentBlock
+		if head.BlockInfo().Number != test.number {
+			t.Errorf("expected head #%d, got #%d", test.number, head.BlockInfo().Number)
+		}
+		if balance := head.GetAddr(to).Amount; balance.Cmp(big.NewInt(test.balance)) != 0 {
+			t.Errorf("expected a balance of %d, got %v", test.balance, balance)
+		}
+	}
+
+	root := nodeBytes(chain[2].State().Root)
+	if data, _ := second.bc.db.Get(root); len(data) != 0 {
+		t.Error("expected the state of the last block to be missing from the second database")
+	}
+	if data, _ := first.bc.db.Get(root); len(data) == 0 {
+		t.Error("expected the state of the last block in the first database")
+	}
+}
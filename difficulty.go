@@ -0,0 +1,47 @@
+package ethchain
+
+import (
+	"math/big"
+)
+
+// Target time in seconds between two consecutive blocks
+const BlockTargetTime = 42
+
+type DifficultyCalculator interface {
+	// Calculates the difficulty a block created at the given time on top of
+	// parent is required to have
+	CalcDifficulty(parent *BlockHeader, time int64) *big.Int
+}
+
+// The adjustment rule nudges the parent's difficulty 1/1024 up if the block
+// was found within the target time and 1/1024 down otherwise.
+type AdjustingDifficulty struct {
+	// Target time between blocks in seconds
+	TargetTime int64
+	// The parent difficulty is divided by this value to get the adjustment
+	BoundDivisor *big.Int
+}
+
+func NewAdjustingDifficulty() *AdjustingDifficulty {
+	return &AdjustingDifficulty{
+		TargetTime:   BlockTargetTime,
+		BoundDivisor: big.NewInt(1024),
+	}
+}
+
+func (calc *AdjustingDifficulty) CalcDifficulty(parent *BlockHeader, time int64) *big.Int {
+	var mul *big.Int
+	if time < parent.Time+calc.TargetTime {
+		mul = big.NewInt(1)
+	} else {
+		mul = big.NewInt(-1)
+	}
+
+	diff := new(big.Int)
+	diff.Add(diff, parent.Difficulty)
+	diff.Div(diff, calc.BoundDivisor)
+	diff.Mul(diff, mul)
+	diff.Add(diff, parent.Difficulty)
+
+	return diff
+}
@@ -0,0 +1,21 @@
+package ethchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestAdjustingDifficulty(t *testing.T) {
+	calc := NewAdjustingDifficulty()
+	parent := &BlockHeader{Time: 1000, Difficulty: big.NewInt(1024 * 1000)}
+
+	// Found within the target time, difficulty goes up
+	if diff := calc.CalcDifficulty(parent, parent.Time+10); diff.Cmp(big.NewInt(1025*1000)) != 0 {
+		t.Errorf("expected difficulty to increase to %v, got %v", 1025*1000, diff)
+	}
+
+	// Found after the target time, difficulty goes down
+	if diff := calc.CalcDifficulty(parent, parent.Time+BlockTargetTime); diff.Cmp(big.NewInt(1023*1000)) != 0 {
+		t.Errorf("expected difficulty to decrease to %v, got %v", 1023*1000, diff)
+	}
+}
@@ -0,0 +1,75 @@
+package ethchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Outcome of processing a block
+type ImportResult int
+
+const (
+	// The block wasn't imported. Returned together with the error telling
+	// why
+	Invalid ImportResult = iota
+	// The block was imported and is the new head of the chain
+	Imported
+	// The block was already known
+	Known
+	// The block was imported but its chain has less total difficulty than
+	// the canonical chain
+	SideChain
+	// The block's parent is unknown. It's kept in the orphan pool until the
+	// parent arrives
+	Orphan
+	// The block is slightly ahead of the local clock. It's queued until its
+	// time has come
+	Future
+)
+
+func (r ImportResult) String() string {
+	switch r {
+	case Invalid:
+		return "invalid"
+	case Imported:
+		return "imported"
+	case Known:
+		return "known"
+	case SideChain:
+		return "side chain"
+	case Orphan:
+		return "orphan"
+	case Future:
+		return "future"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(r))
+}
+
+// Errors returned while processing blocks. The returned errors wrap one of
+// these and carry the details, use errors.Is to test for them. Every one of
+// them means the block is invalid, except for ErrFutureQueueFull, ErrStopped
+// and ErrStatePruned.
+var (
+	ErrUnknownParent     = errors.New("Block's parent unknown")
+	ErrInvalidParent     = errors.New("Header's parent mismatch")
+	ErrInvalidPoW        = errors.New("Block's nonce is invalid")
+	ErrInvalidDifficulty = errors.New("Invalid difficulty")
+	ErrInvalidTimestamp  = errors.New("Invalid block timestamp")
+	ErrFutureBlock       = errors.New("Block is too far in the future")
+	ErrInvalidUncle      = errors.New("Invalid uncle")
+	ErrInvalidBody       = errors.New("Block body doesn't match its header")
+	ErrInvalidStateRoot  = errors.New("Invalid merkle root")
+	ErrBlockLimit        = errors.New("Block exceeds limits")
+	ErrInvalidTx         = errors.New("Invalid transaction")
+	ErrMalformedBlock    = errors.New("Malformed block")
+
+	// The block itself might be valid but can't be held back right now
+	ErrFutureQueueFull = errors.New("Future block queue is full")
+	// The block manager was stopped before the block could be imported
+	ErrStopped = errors.New("Block manager stopped")
+)
+
+// Returned when the state of a block was pruned and can't be read anymore.
+// Blocks built on a parent whose state was pruned can't be imported
+var ErrStatePruned = errors.New("State not available")
@@ -0,0 +1,135 @@
+package ethchain
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Posted for every block that was imported, whether it became the head of
+// the chain or not
+type NewBlockEvent struct {
+	Block  *Block
+	Result ImportResult
+}
+
+// Posted when a block became the new head of the chain
+type ChainHeadEvent struct {
+	Block *Block
+}
+
+// Posted when a block was imported on a side chain
+type ChainSideEvent struct {
+	Block *Block
+}
+
+// Posted when the canonical chain was reorganised. Both lists are ordered
+// from newest to oldest and exclude the common ancestor.
+type ReorgEvent struct {
+	// Blocks which are no longer canonical
+	OldChain []*Block
+	// Blocks which became canonical
+	NewChain []*Block
+}
+
+// Posted when a transaction was added to the pool
+type NewTxEvent struct {
+	Tx *Transaction
+}
+
+// The event mux delivers posted events to each of its subscribers. Posting
+// never blocks: every subscriber has its own buffer and events which don't
+// fit in a full buffer are dropped for that subscriber.
+type EventMux struct {
+	mutex sync.RWMutex
+	subs  map[*Subscription]bool
+}
+
+func NewEventMux() *EventMux {
+	return &EventMux{subs: make(map[*Subscription]bool)}
+}
+
+type Subscription struct {
+	mux *EventMux
+	ch  chan interface{}
+	// Event types the subscriber is interested in. Nil means all events
+	types []interface{}
+
+	mutex   sync.Mutex
+	dropped uint64
+}
+
+// Subscribes to the events of the same type as the given example events, e.g.
+// Subscribe(16, ChainHeadEvent{}, ReorgEvent{}). Without any types every
+// event is delivered.
+func (mux *EventMux) Subscribe(bufSize int, types ...interface{}) *Subscription {
+	sub := &Subscription{
+		mux:   mux,
+		ch:    make(chan interface{}, bufSize),
+		types: types,
+	}
+
+	mux.mutex.Lock()
+	mux.subs[sub] = true
+	mux.mutex.Unlock()
+
+	return sub
+}
+
+// Delivers the event to every interested subscriber without blocking
+func (mux *EventMux) Post(ev interface{}) {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+
+	for sub := range mux.subs {
+		if !sub.wants(ev) {
+			continue
+		}
+
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.mutex.Lock()
+			sub.dropped++
+			sub.mutex.Unlock()
+		}
+	}
+}
+
+// Returns the channel the events are delivered on. The channel is closed
+// when unsubscribing.
+func (sub *Subscription) Chan() <-chan interface{} {
+	return sub.ch
+}
+
+// Stops the delivery of events and closes the channel
+func (sub *Subscription) Unsubscribe() {
+	sub.mux.mutex.Lock()
+	defer sub.mux.mutex.Unlock()
+
+	if sub.mux.subs[sub] {
+		delete(sub.mux.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Returns the amount of events dropped because the buffer was full
+func (sub *Subscription) Dropped() uint64 {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	return sub.dropped
+}
+
+func (sub *Subscription) wants(ev interface{}) bool {
+	if sub.types == nil {
+		return true
+	}
+
+	for _, typ := range sub.types {
+		if reflect.TypeOf(typ) == reflect.TypeOf(ev) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+package ethchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEventMuxDelivery(t *testing.T) {
+	mux := NewEventMux()
+	heads := mux.Subscribe(1, ChainHeadEvent{})
+	all := mux.Subscribe(10)
+
+	mux.Post(ChainHeadEvent{})
+	mux.Post(NewTxEvent{})
+	// The head subscriber's buffer is full. Posting must not block
+	mux.Post(ChainHeadEvent{})
+
+	if ev := <-heads.Chan(); ev != (ChainHeadEvent{}) {
+		t.Errorf("expected head event, got %v", ev)
+	}
+	if heads.Dropped() != 1 {
+		t.Errorf("expected 1 dropped event, got %d", heads.Dropped())
+	}
+	if len(all.Chan()) != 3 {
+		t.Errorf("expected 3 events, got %d", len(all.Chan()))
+	}
+}
+
+func TestEventMuxUnsubscribe(t *testing.T) {
+	mux := NewEventMux()
+	sub := mux.Subscribe(1)
+	sub.Unsubscribe()
+	// Unsubscribing twice is harmless
+	sub.Unsubscribe()
+
+	mux.Post(NewTxEvent{})
+	if _, ok := <-sub.Chan(); ok {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestTxPoolHook(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	pool := NewTxPool()
+	pool.BlockManager = bm
+	pool.Hook = make(TxPoolHook)
+	pool.Start()
+	defer pool.Stop()
+
+	tx := NewTransaction(make([]byte, 20), big.NewInt(1), nil)
+	bm.Events.Post(NewTxEvent{Tx: tx})
+	if hooked := <-pool.Hook; hooked != tx {
+		t.Errorf("expected %x on the hook, got %x", tx.Hash(), hooked.Hash())
+	}
+}
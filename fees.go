@@ -17,6 +17,13 @@ var Period2Reward *big.Int = new(big.Int)
 var Period3Reward *big.Int = new(big.Int)
 var Period4Reward *big.Int = new(big.Int)
 
+// Returns the fee of a transaction: the base fee plus a fee per data item
+func CalculateTxFee(tx *Transaction) *big.Int {
+	fee := new(big.Int).Mul(DataFee, big.NewInt(int64(len(tx.Data))))
+
+	return fee.Add(fee, TxFee)
+}
+
 func InitFees() {
 	// Base for 2**64
 	b60 := new(big.Int)
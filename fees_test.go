@@ -0,0 +1,141 @@
+package ethchain
+
+import (
+	"errors"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+	"testing"
+)
+
+// Sets the fees for the duration of a test. Call the returned function to
+// restore them
+func setTestFees(txFee, dataFee int64) func() {
+	tx, data := TxFee, DataFee
+	TxFee, DataFee = big.NewInt(txFee), big.NewInt(dataFee)
+
+	return func() {
+		TxFee, DataFee = tx, data
+	}
+}
+
+func TestCalculateTxFee(t *testing.T) {
+	defer setTestFees(100, 10)()
+
+	for data, exp := range map[int]int64{0: 100, 1: 110, 3: 130} {
+		tx := NewTransaction(ZeroHash160, big.NewInt(1), make([]string, data))
+		if fee := CalculateTxFee(tx); fee.Cmp(big.NewInt(exp)) != 0 {
+			t.Errorf("%d data item(s): expected a fee of %d, got %v", data, exp, fee)
+		}
+	}
+}
+
+func TestPayTxFee(t *testing.T) {
+	defer setTestFees(100, 10)()
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+
+	to := make([]byte, 20)
+	to[0] = 1
+	coinbase := make([]byte, 20)
+	coinbase[0] = 2
+	tx := NewTransaction(to, big.NewInt(1000), make([]string, 2))
+	tx.Sign(testKey)
+	block := GenerateChain(bm.bc.GenesisBlock(), 1, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase(coinbase)
+		gen.AddTx(tx)
+	})[0]
+	if _, err := bm.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	head := bm.bc.CurrentBlock
+	balance := new(big.Int).Sub(ethutil.BigPow(2, 64), big.NewInt(1120))
+	for _, test := range []struct {
+		addr    []byte
+		balance *big.Int
+	}{
+		{testAddress(), balance},
+		{to, big.NewInt(1000)},
+		{coinbase, big.NewInt(120)},
+	} {
+		if amount := head.GetAddr(test.addr).Amount; amount.Cmp(test.balance) != 0 {
+			t.Errorf("%x: expected a balance of %v, got %v", test.addr, test.balance, amount)
+		}
+	}
+
+	receipts := bm.bc.GetReceipts(block.Hash())
+	if len(receipts) != 1 || receipts[0].Fee.Cmp(big.NewInt(120)) != 0 {
+		t.Errorf("expected a receipt with a fee of 120, got %v", receipts)
+	}
+}
+
+// A sender who can't pay the fee makes the transaction invalid, in debug
+// mode too
+func TestPayTxFeeInsufficient(t *testing.T) {
+	defer setTestFees(100, 0)()
+	defer setDebug(true)()
+
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	block := genesis.CopyWithState(genesis.State().Root)
+	tx := newTestTx(0, ZeroHash160, 0)
+	if _, err := bm.ApplyTransactions(block, []*Transaction{tx}); !errors.Is(err, ErrInvalidTx) {
+		t.Errorf("expected ErrInvalidTx, got %v", err)
+	}
+}
+
+// Returns a function restoring the debug flag after setting it
+func setDebug(debug bool) func() {
+	old := ethutil.Config.Debug
+	ethutil.Config.Debug = debug
+
+	return func() {
+		ethutil.Config.Debug = old
+	}
+}
+
+// Debug nodes don't make up the value a sender can't pay
+func TestProcessTransactionInsufficient(t *testing.T) {
+	defer setDebug(true)()
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+
+	genesis := bm.bc.GenesisBlock()
+	block := genesis.CopyWithState(genesis.State().Root)
+	receipts, err := bm.ApplyTransactions(block, []*Transaction{newTestTx(0, ZeroHash160, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipts[0].Status != ReceiptFailed {
+		t.Errorf("expected the transaction to fail, got status %v", receipts[0].Status)
+	}
+	if amount := block.GetAddr(testAddress()).Amount; amount.Sign() != 0 {
+		t.Errorf("expected the sender's balance to stay 0, got %v", amount)
+	}
+}
+
+func TestValidateTransactionFee(t *testing.T) {
+	defer setTestFees(100, 10)()
+	// Debug nodes don't accept them either
+	defer setDebug(true)()
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+	pool := NewTxPool()
+	pool.BlockManager = bm
+
+	// The sender can pay the value or the fee but not both
+	value := new(big.Int).Sub(ethutil.BigPow(2, 64), big.NewInt(109))
+	tx := NewTransaction(ZeroHash160, value, make([]string, 1))
+	tx.Sign(testKey)
+	if err := pool.ValidateTransaction(tx); err == nil {
+		t.Error("expected an error for a sender short of the fee")
+	}
+
+	tx = NewTransaction(ZeroHash160, value.Sub(value, big.NewInt(1)), make([]string, 1))
+	tx.Sign(testKey)
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Errorf("expected the transaction to be valid, got %v", err)
+	}
+}
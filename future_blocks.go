@@ -0,0 +1,73 @@
+package ethchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Blocks further ahead of the local clock than this (in seconds) are
+	// rejected. Blocks within this window are queued until their time has
+	// come.
+	MaxFutureBlockTime = 30
+	// Maximum amount of blocks held in the future queue
+	futureBlocksLimit = 256
+)
+
+// The clock is the local time source block timestamps are judged against
+type Clock interface {
+	Now() time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Queue of blocks whose timestamp is ahead of the local clock
+type futureBlocks struct {
+	mutex  sync.Mutex
+	blocks map[string]*Block
+}
+
+func newFutureBlocks() *futureBlocks {
+	return &futureBlocks{blocks: make(map[string]*Block)}
+}
+
+// Queues the block. Returns false if the queue is full
+func (q *futureBlocks) add(block *Block) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.blocks) >= futureBlocksLimit {
+		return false
+	}
+	q.blocks[string(block.Hash())] = block
+
+	return true
+}
+
+// Removes and returns the queued blocks whose time has come, oldest first
+func (q *futureBlocks) due(now int64) []*Block {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var blocks []*Block
+	for hash, block := range q.blocks {
+		if block.Time <= now {
+			blocks = append(blocks, block)
+			delete(q.blocks, hash)
+		}
+	}
+	sort.Sort(blocksByTime(blocks))
+
+	return blocks
+}
+
+type blocksByTime []*Block
+
+func (b blocksByTime) Len() int           { return len(b) }
+func (b blocksByTime) Less(i, j int) bool { return b[i].Time < b[j].Time }
+func (b blocksByTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -0,0 +1,76 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Clock which only moves when told to
+type testClock struct {
+	now int64
+}
+
+func (c *testClock) Now() time.Time {
+	return time.Unix(atomic.LoadInt64(&c.now), 0)
+}
+
+func (c *testClock) set(now int64) {
+	atomic.StoreInt64(&c.now, now)
+}
+
+func TestFutureBlocks(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+	clock := &testClock{}
+	bm.Clock = clock
+
+	// The genesis has timestamp 0, its child 10
+	genesis := bm.bc.GenesisBlock()
+	block := GenerateChain(genesis, 1, nil)[0]
+	if result, err := bm.ProcessBlock(block); err != nil || result != Future {
+		t.Fatalf("expected the block to be queued, got %v (%v)", result, err)
+	}
+	if !bytes.Equal(bm.bc.Head().Hash, genesis.Hash()) {
+		t.Error("expected the queued block not to be the head")
+	}
+
+	// Blocks too far ahead are rejected
+	far := GenerateChain(genesis, 1, func(_ int, gen *BlockGen) {
+		gen.SetTime(MaxFutureBlockTime + 1)
+	})[0]
+	if result, err := bm.ProcessBlock(far); result != Invalid || !errors.Is(err, ErrFutureBlock) {
+		t.Errorf("expected ErrFutureBlock, got %v (%v)", result, err)
+	}
+
+	// So are blocks which would be invalid once their time has come
+	invalid := GenerateChain(genesis, 1, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{1})
+	})[0]
+	invalid.Difficulty = new(big.Int).Add(invalid.Difficulty, big.NewInt(1))
+	if _, err := bm.ProcessBlock(invalid); !errors.Is(err, ErrInvalidDifficulty) {
+		t.Errorf("expected ErrInvalidDifficulty, got %v", err)
+	}
+	if len(bm.futureBlocks.blocks) != 1 {
+		t.Errorf("expected 1 queued block, got %d", len(bm.futureBlocks.blocks))
+	}
+
+	// Nothing is due yet
+	clock.set(9)
+	bm.ProcessFutureBlocks()
+	if !bytes.Equal(bm.bc.Head().Hash, genesis.Hash()) {
+		t.Error("expected the block to stay queued")
+	}
+
+	clock.set(10)
+	bm.ProcessFutureBlocks()
+	if !bytes.Equal(bm.bc.Head().Hash, block.Hash()) {
+		t.Errorf("expected the queued block to become the head")
+	}
+	if len(bm.futureBlocks.blocks) != 0 {
+		t.Errorf("expected the queue to be empty, got %d", len(bm.futureBlocks.blocks))
+	}
+}
@@ -1,7 +1,14 @@
 package ethchain
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/ethereum/ethutil-go"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"strings"
 )
 
 /*
@@ -12,25 +19,216 @@ var ZeroHash256 = make([]byte, 32)
 var ZeroHash160 = make([]byte, 20)
 var EmptyShaList = ethutil.Sha3Bin(ethutil.Encode([]interface{}{}))
 
-var GenisisHeader = []interface{}{
-	// Previous hash (none)
-	"",
-	// Sha of uncles
-	EmptyShaList,
-	// Coinbase
-	"",
-	// Root state
-	"",
-	// Sha of transactions
-	EmptyShaList,
-	// Difficulty
-	ethutil.BigPow(2, 22),
-	// Time
-	uint64(0),
-	// Nonce
-	nil,
-	// Extra
-	"",
-}
-
-var Genesis = []interface{}{GenisisHeader, []interface{}{}, []interface{}{}}
+// Initial state of an account in the genesis block
+type GenesisAccount struct {
+	Balance *big.Int
+	// Contract code, one instruction per item
+	Code []string
+	// Contract storage
+	Storage map[string]*big.Int
+}
+
+// The genesis specification from which the genesis block and its state are
+// built
+type Genesis struct {
+	Coinbase   []byte
+	Difficulty *big.Int
+	Time       int64
+	Nonce      *big.Int
+	Extra      string
+	// Initial accounts keyed by address
+	Alloc map[string]*GenesisAccount
+}
+
+// The genesis of the test net
+func DefaultGenesis() *Genesis {
+	genesis := &Genesis{
+		Coinbase:   []byte{},
+		Difficulty: ethutil.BigPow(2, 22),
+		Time:       0,
+		Nonce:      new(big.Int),
+		Extra:      "",
+		Alloc:      make(map[string]*GenesisAccount),
+	}
+
+	for _, addr := range []string{
+		"812413ae7e515a3bcaf7b3444116527bce958c02", // Gavin
+		"93658b04240e4bd4046fd2d6d417d20f146f4b43", // Jeffrey
+	} {
+		codedAddr, _ := hex.DecodeString(addr)
+		genesis.Alloc[string(codedAddr)] = &GenesisAccount{Balance: ethutil.BigPow(2, 32)}
+	}
+
+	return genesis
+}
+
+// Genesis file format. Numbers may be given in decimal or as 0x prefixed hex.
+//
+//	{
+//	  "coinbase": "0x...",
+//	  "difficulty": "4194304",
+//	  "timestamp": 0,
+//	  "nonce": "0",
+//	  "extraData": "",
+//	  "alloc": {
+//	    "812413ae7e515a3bcaf7b3444116527bce958c02": {"balance": "4294967296"},
+//	    "...": {"balance": "0", "code": ["PUSH", "1", "STOP"], "storage": {"0": "42"}}
+//	  }
+//	}
+type genesisJSON struct {
+	Coinbase   string                        `json:"coinbase"`
+	Difficulty string                        `json:"difficulty"`
+	Timestamp  uint64                        `json:"timestamp"`
+	Nonce      string                        `json:"nonce"`
+	ExtraData  string                        `json:"extraData"`
+	Alloc      map[string]genesisAccountJSON `json:"alloc"`
+}
+
+type genesisAccountJSON struct {
+	Balance string            `json:"balance"`
+	Code    []string          `json:"code"`
+	Storage map[string]string `json:"storage"`
+}
+
+// Loads the genesis specification from a JSON file
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseGenesis(data)
+}
+
+func ParseGenesis(data []byte) (*Genesis, error) {
+	var spec genesisJSON
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("Invalid genesis file: %v", err)
+	}
+
+	coinbase, err := parseHex(spec.Coinbase)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid genesis coinbase: %v", err)
+	}
+
+	difficulty, err := parseBig(spec.Difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid genesis difficulty: %v", err)
+	}
+
+	nonce, err := parseBig(spec.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid genesis nonce: %v", err)
+	}
+
+	genesis := &Genesis{
+		Coinbase:   coinbase,
+		Difficulty: difficulty,
+		Time:       int64(spec.Timestamp),
+		Nonce:      nonce,
+		Extra:      spec.ExtraData,
+		Alloc:      make(map[string]*GenesisAccount),
+	}
+
+	for addr, account := range spec.Alloc {
+		codedAddr, err := parseHex(addr)
+		if err != nil || len(codedAddr) != 20 {
+			return nil, fmt.Errorf("Invalid genesis address %q", addr)
+		}
+
+		balance, err := parseBig(account.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid balance for %s: %v", addr, err)
+		}
+
+		storage := make(map[string]*big.Int)
+		for k, v := range account.Storage {
+			key, err := parseBig(k)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid storage key %q for %s: %v", k, addr, err)
+			}
+			value, err := parseBig(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid storage value %q for %s: %v", v, addr, err)
+			}
+			storage[key.String()] = value
+		}
+
+		code := make([]string, len(account.Code))
+		for i, instr := range account.Code {
+			code[i], err = ethutil.CompileInstr(instr)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid code for %s at %d: %v", addr, i, err)
+			}
+		}
+
+		genesis.Alloc[string(codedAddr)] = &GenesisAccount{Balance: balance, Code: code, Storage: storage}
+	}
+
+	return genesis, nil
+}
+
+// Builds the genesis block and writes the allocations to its state in db
+func (genesis *Genesis) Block(db Database) *Block {
+	header := []interface{}{
+		// Previous hash (none)
+		"",
+		// Sha of uncles
+		EmptyShaList,
+		// Coinbase
+		genesis.Coinbase,
+		// Root state
+		"",
+		// Sha of transactions
+		EmptyShaList,
+		// Difficulty
+		genesis.Difficulty,
+		// Time
+		uint64(genesis.Time),
+		// Nonce. Part of the genesis hash but not of its seal hash
+		genesis.Nonce,
+		// Extra
+		genesis.Extra,
+	}
+	block := newBlockFromData(db, ethutil.Encode([]interface{}{header, []interface{}{}, []interface{}{}}))
+
+	for addr, account := range genesis.Alloc {
+		log.Printf("Genesis allocates %v Wei to %x\n", account.Balance, addr)
+
+		// Accounts without code or storage are plain addresses
+		if len(account.Code) == 0 && len(account.Storage) == 0 {
+			address := NewAddress(new(big.Int).Set(account.Balance))
+			block.UpdateAddr([]byte(addr), address)
+
+			continue
+		}
+
+		contract := NewContract(db, new(big.Int).Set(account.Balance), []byte(""))
+		for i, instr := range account.Code {
+			contract.State().Update(string(ethutil.NumberToBytes(uint64(i), 32)), instr)
+		}
+		for key, value := range account.Storage {
+			contract.State().Update(key, string(ethutil.Encode(value)))
+		}
+		block.UpdateContract([]byte(addr), contract)
+	}
+
+	return block
+}
+
+func parseHex(str string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(str, "0x"))
+}
+
+func parseBig(str string) (*big.Int, error) {
+	if str == "" {
+		return new(big.Int), nil
+	}
+
+	num, ok := new(big.Int).SetString(str, 0)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number", str)
+	}
+
+	return num, nil
+}
@@ -0,0 +1,79 @@
+package ethchain
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestParseGenesisDefault(t *testing.T) {
+	exp := DefaultGenesis().Block(newSyncMemDatabase())
+
+	// The test net's genesis with numbers in hex and in decimal
+	for _, spec := range []string{
+		`{"difficulty": "0x400000", "alloc": {
+			"0x812413ae7e515a3bcaf7b3444116527bce958c02": {"balance": "0x100000000"},
+			"93658b04240e4bd4046fd2d6d417d20f146f4b43": {"balance": "0x100000000"}}}`,
+		`{"difficulty": "4194304", "timestamp": 0, "nonce": "0", "alloc": {
+			"812413ae7e515a3bcaf7b3444116527bce958c02": {"balance": "4294967296"},
+			"93658b04240e4bd4046fd2d6d417d20f146f4b43": {"balance": "4294967296"}}}`,
+	} {
+		genesis, err := ParseGenesis([]byte(spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block := genesis.Block(newSyncMemDatabase())
+		if !block.State().Cmp(exp.State()) {
+			t.Errorf("expected state root %x, got %x", exp.State().Root, block.State().Root)
+		}
+		if !bytes.Equal(block.Hash(), exp.Hash()) {
+			t.Errorf("expected genesis %x, got %x", exp.Hash(), block.Hash())
+		}
+	}
+}
+
+func TestParseGenesisContract(t *testing.T) {
+	genesis, err := ParseGenesis([]byte(`{"difficulty": "0x400000", "alloc": {
+		"0x0000000000000000000000000000000000000001": {
+			"balance": "5",
+			"code": ["PUSH", "1", "STOP"],
+			"storage": {"0x10": "42", "3": "0x07"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := make([]byte, 20)
+	addr[19] = 1
+	block := genesis.Block(newSyncMemDatabase())
+	contract := block.GetContract(addr)
+	if contract == nil {
+		t.Fatal("expected the contract to exist")
+	}
+	if contract.Amount.Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("expected a balance of 5, got %v", contract.Amount)
+	}
+
+	// Storage is read the way SLOAD reads it
+	for key, exp := range map[int64]int64{16: 42, 3: 7, 4: 0} {
+		if value := getContractMemory(block, addr, big.NewInt(key)); value.Cmp(big.NewInt(exp)) != 0 {
+			t.Errorf("storage %d: expected %d, got %v", key, exp, value)
+		}
+	}
+}
+
+func TestParseGenesisErrors(t *testing.T) {
+	for i, spec := range []string{
+		`{"alloc": {"812413ae7e515a3bcaf7b3444116527bce958c": {"balance": "1"}}}`,
+		`{"alloc": {"zz2413ae7e515a3bcaf7b3444116527bce958c02": {"balance": "1"}}}`,
+		`{"alloc": {"812413ae7e515a3bcaf7b3444116527bce958c02": {"balance": "one"}}}`,
+		`{"alloc": {"812413ae7e515a3bcaf7b3444116527bce958c02": {"storage": {"x": "1"}}}}`,
+		`{"difficulty": "0xzz"}`,
+		`{"coinbase": "0x123"}`,
+		`{"alloc": []}`,
+	} {
+		if _, err := ParseGenesis([]byte(spec)); err == nil {
+			t.Errorf("spec %d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ethchain
+
+import (
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"log"
+)
+
+// LevelDB database which commits batches atomically. Use it instead of
+// ethutil's LevelDB database for storing a chain.
+type LDBDatabase struct {
+	db *leveldb.DB
+}
+
+// Opens or creates the database in the given directory
+func NewLDBDatabase(file string) (*LDBDatabase, error) {
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LDBDatabase{db: db}, nil
+}
+
+func (db *LDBDatabase) Put(key []byte, value []byte) {
+	if err := db.db.Put(key, value, nil); err != nil {
+		log.Println("[DB] Put failed:", err)
+	}
+}
+
+// Returns the value of the key. Missing keys have an empty value
+func (db *LDBDatabase) Get(key []byte) ([]byte, error) {
+	data, err := db.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (db *LDBDatabase) Delete(key []byte) error {
+	return db.db.Delete(key, nil)
+}
+
+func (db *LDBDatabase) LastKnownTD() []byte {
+	data, _ := db.Get([]byte("LastKnownTotalDifficulty"))
+
+	return data
+}
+
+func (db *LDBDatabase) NewBatch() Batch {
+	return &ldbBatch{db: db.db, batch: new(leveldb.Batch)}
+}
+
+func (db *LDBDatabase) Close() {
+	db.db.Close()
+}
+
+func (db *LDBDatabase) Print() {
+	iter := db.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		fmt.Printf("%x(%d): %x\n", iter.Key(), len(iter.Key()), iter.Value())
+	}
+}
+
+type ldbBatch struct {
+	db    *leveldb.DB
+	batch *leveldb.Batch
+}
+
+func (b *ldbBatch) Put(key, value []byte) {
+	b.batch.Put(key, value)
+}
+
+func (b *ldbBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+func (b *ldbBatch) Write() error {
+	return b.db.Write(b.batch, nil)
+}
@@ -0,0 +1,142 @@
+package ethchain
+
+import (
+	"sync"
+)
+
+const (
+	// Maximum amount of blocks held in the orphan pool
+	orphanBlocksLimit = 512
+	// Orphans older than this (in seconds) are dropped
+	orphanBlockTTL = 10 * 60
+	// Seconds before the ancestors of the same missing block are requested
+	// again
+	ancestorRequestInterval = 60
+)
+
+type orphanBlock struct {
+	block *Block
+	// Local time at which the orphan was added
+	added int64
+}
+
+// Pool of blocks whose parent is unknown. Once the parent has been imported
+// the orphans are taken out of the pool and imported as well.
+type orphanBlocks struct {
+	mutex sync.Mutex
+	// Orphans by hash
+	blocks map[string]*orphanBlock
+	// Hashes of orphans by the hash of their parent
+	children map[string][]string
+	// Local time the ancestors were last requested by the hash of the
+	// missing block
+	requested map[string]int64
+}
+
+func newOrphanBlocks() *orphanBlocks {
+	return &orphanBlocks{
+		blocks:    make(map[string]*orphanBlock),
+		children:  make(map[string][]string),
+		requested: make(map[string]int64),
+	}
+}
+
+// Adds the block to the pool. Expired orphans are dropped and if the pool is
+// full the oldest orphan makes place.
+func (pool *orphanBlocks) add(block *Block, now int64) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	hash := string(block.Hash())
+	if _, exist := pool.blocks[hash]; exist {
+		return
+	}
+
+	var oldest *orphanBlock
+	for _, orphan := range pool.blocks {
+		if now-orphan.added > orphanBlockTTL {
+			pool.remove(orphan.block)
+		} else if oldest == nil || orphan.added < oldest.added {
+			oldest = orphan
+		}
+	}
+	if len(pool.blocks) >= orphanBlocksLimit && oldest != nil {
+		pool.remove(oldest.block)
+	}
+
+	for missing, requested := range pool.requested {
+		if now-requested >= ancestorRequestInterval {
+			delete(pool.requested, missing)
+		}
+	}
+
+	pool.blocks[hash] = &orphanBlock{block: block, added: now}
+	parent := string(block.PrevHash)
+	pool.children[parent] = append(pool.children[parent], hash)
+}
+
+// Removes and returns the orphans whose parent has the given hash
+func (pool *orphanBlocks) take(parent []byte) []*Block {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	var blocks []*Block
+	for _, hash := range pool.children[string(parent)] {
+		if orphan, exist := pool.blocks[hash]; exist {
+			blocks = append(blocks, orphan.block)
+			delete(pool.blocks, hash)
+		}
+	}
+	delete(pool.children, string(parent))
+	delete(pool.requested, string(parent))
+
+	return blocks
+}
+
+// Returns the hash of the missing ancestor of the block unless its ancestors
+// were requested recently, in which case nil is returned. Requests for the
+// returned hash are counted from now on.
+func (pool *orphanBlocks) ancestorToRequest(block *Block, now int64) []byte {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	missing := pool.missingAncestor(block)
+	if requested, exist := pool.requested[string(missing)]; exist && now-requested < ancestorRequestInterval {
+		return nil
+	}
+	pool.requested[string(missing)] = now
+
+	return missing
+}
+
+// Returns the hash of the missing ancestor of the block by following its
+// ancestry through the pool. Expects the mutex to be held
+func (pool *orphanBlocks) missingAncestor(block *Block) []byte {
+	hash := block.PrevHash
+	for orphan, exist := pool.blocks[string(hash)]; exist; orphan, exist = pool.blocks[string(hash)] {
+		hash = orphan.block.PrevHash
+	}
+
+	return hash
+}
+
+// Unexported. Expects the mutex to be held
+func (pool *orphanBlocks) remove(block *Block) {
+	hash := string(block.Hash())
+	delete(pool.blocks, hash)
+
+	parent := string(block.PrevHash)
+	siblings := pool.children[parent]
+	for i, sibling := range siblings {
+		if sibling == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	if len(siblings) == 0 {
+		delete(pool.children, parent)
+	} else {
+		pool.children[parent] = siblings
+	}
+}
@@ -0,0 +1,130 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ethereum/ethwire-go"
+	"math/big"
+	"testing"
+)
+
+// Proof of work which only accepts the nonce generated blocks have
+type zeroNoncePow struct{}
+
+func (pow zeroNoncePow) Search(block *Block) *big.Int {
+	return big.NewInt(0)
+}
+
+func (pow zeroNoncePow) Verify(hash []byte, diff, nonce *big.Int) bool {
+	return nonce.Sign() == 0
+}
+
+// Returns a distinct block whose parent is missing
+func newOrphan(parent []byte, extra int) *Block {
+	block := CreateBlock(nil, "", parent, ZeroHash160, big.NewInt(1), big.NewInt(0), "", nil)
+	block.Time = int64(extra)
+
+	return block
+}
+
+func TestOrphanPoolLimits(t *testing.T) {
+	pool := newOrphanBlocks()
+
+	// The oldest orphan makes place once the pool is full
+	for i := 0; i <= orphanBlocksLimit; i++ {
+		pool.add(newOrphan([]byte{1}, i), int64(i))
+	}
+	if len(pool.blocks) != orphanBlocksLimit {
+		t.Errorf("expected %d orphans, got %d", orphanBlocksLimit, len(pool.blocks))
+	}
+	if _, exist := pool.blocks[string(newOrphan([]byte{1}, 0).Hash())]; exist {
+		t.Error("expected the oldest orphan to be dropped")
+	}
+
+	// Expired orphans are dropped when the next one arrives
+	pool.add(newOrphan([]byte{2}, 0), orphanBlocksLimit+orphanBlockTTL+1)
+	if len(pool.blocks) != 1 {
+		t.Errorf("expected the expired orphans to be dropped, got %d", len(pool.blocks))
+	}
+
+	if blocks := pool.take([]byte{2}); len(blocks) != 1 {
+		t.Errorf("expected 1 child, got %d", len(blocks))
+	}
+	if len(pool.blocks) != 0 || len(pool.children) != 0 {
+		t.Error("expected the pool to be empty")
+	}
+}
+
+func TestOrphanImport(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+	bm.Pow = zeroNoncePow{}
+	speaker := &testSpeaker{}
+	bm.Speaker = speaker
+
+	chain := GenerateChain(bm.bc.GenesisBlock(), 4, nil)
+
+	// Orphans without a valid proof of work are rejected
+	junk := chain[3].CopyWithState(chain[3].State().Root)
+	junk.Nonce = big.NewInt(1)
+	if _, err := bm.ProcessBlock(junk); !errors.Is(err, ErrInvalidPoW) {
+		t.Errorf("expected ErrInvalidPoW, got %v", err)
+	}
+
+	for _, block := range chain[1:] {
+		if result, err := bm.ProcessBlock(block); err != nil || result != Orphan {
+			t.Fatalf("expected an orphan, got %v (%v)", result, err)
+		}
+	}
+	// The orphans are all missing the same ancestor
+	if n := speaker.count(ethwire.MsgGetChainTy); n != 1 {
+		t.Errorf("expected the ancestors to be requested once, got %d", n)
+	}
+
+	// Once the parent arrives the orphans follow
+	if result, err := bm.ProcessBlock(chain[0]); err != nil || result != Imported {
+		t.Fatalf("expected the parent to be imported, got %v (%v)", result, err)
+	}
+	if head := bm.bc.Head(); head.Number != 5 || !bytes.Equal(head.Hash, chain[3].Hash()) {
+		t.Errorf("expected head #5 (%x), got #%d (%x)", chain[3].Hash(), head.Number, head.Hash)
+	}
+	if len(bm.orphans.blocks) != 0 || len(bm.orphans.requested) != 0 {
+		t.Error("expected the orphan pool to be empty")
+	}
+}
+
+// A full pool of orphans on two forks is imported once their common parent
+// arrives
+func TestOrphanChainImport(t *testing.T) {
+	bm := newTestBlockManager(nil)
+	defer bm.Stop()
+	bm.Pow = zeroNoncePow{}
+
+	genesis := bm.bc.GenesisBlock()
+	parent := GenerateChain(genesis, 1, nil)[0]
+	long := GenerateChain(parent, orphanBlocksLimit-2, nil)
+	short := GenerateChain(parent, 2, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{1})
+	})
+	for _, block := range append(short, long...) {
+		if result, err := bm.ProcessBlock(block); err != nil || result != Orphan {
+			t.Fatalf("expected an orphan, got %v (%v)", result, err)
+		}
+	}
+
+	if result, err := bm.ProcessBlock(parent); err != nil || result != Imported {
+		t.Fatalf("expected the parent to be imported, got %v (%v)", result, err)
+	}
+	head := long[len(long)-1]
+	if !bytes.Equal(bm.bc.Head().Hash, head.Hash()) {
+		t.Errorf("expected the long fork's last block %x as head, got %x", head.Hash(), bm.bc.Head().Hash)
+	}
+	for _, block := range short {
+		if !bm.bc.HasBlock(block.Hash()) {
+			t.Errorf("expected side block %x to be imported", block.Hash())
+		}
+	}
+	if len(bm.orphans.blocks) != 0 {
+		t.Errorf("expected the orphan pool to be empty, got %d", len(bm.orphans.blocks))
+	}
+}
@@ -0,0 +1,96 @@
+package ethchain
+
+import (
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+)
+
+type ReceiptStatus byte
+
+const (
+	// The transaction was applied
+	ReceiptOk ReceiptStatus = iota
+	// The transaction couldn't be applied (e.g. insufficient funds)
+	ReceiptFailed
+	// The contract execution was aborted by the VM
+	ReceiptVmError
+)
+
+func (s ReceiptStatus) String() string {
+	switch s {
+	case ReceiptOk:
+		return "ok"
+	case ReceiptFailed:
+		return "failed"
+	case ReceiptVmError:
+		return "vm error"
+	}
+
+	return fmt.Sprintf("unknown(%d)", byte(s))
+}
+
+// A receipt records the outcome of a single transaction applied to a block
+type Receipt struct {
+	TxHash []byte
+	// Root of the state trie after the transaction was applied
+	PostState interface{}
+	// Fees charged for the transaction
+	Fee    *big.Int
+	Status ReceiptStatus
+	// Address of the created contract. Only set for contract transactions
+	ContractAddress []byte
+}
+
+func NewReceiptFromRlpValue(rlpValue *ethutil.RlpValue) *Receipt {
+	receipt := &Receipt{}
+	receipt.RlpValueDecode(rlpValue)
+
+	return receipt
+}
+
+func (r *Receipt) RlpData() interface{} {
+	return []interface{}{r.TxHash, r.PostState, r.Fee, uint64(r.Status), r.ContractAddress}
+}
+
+func (r *Receipt) RlpEncode() []byte {
+	return ethutil.Encode(r.RlpData())
+}
+
+func (r *Receipt) RlpDecode(data []byte) {
+	r.RlpValueDecode(ethutil.NewRlpValueFromBytes(data))
+}
+
+func (r *Receipt) RlpValueDecode(decoder *ethutil.RlpValue) {
+	r.TxHash = decoder.Get(0).AsBytes()
+	r.PostState = decoder.Get(1).AsRaw()
+	r.Fee = decoder.Get(2).AsBigInt()
+	r.Status = ReceiptStatus(decoder.Get(3).AsUint())
+	r.ContractAddress = decoder.Get(4).AsBytes()
+}
+
+func (r *Receipt) String() string {
+	return fmt.Sprintf("Receipt(%x):\nPostState:%x\nFee:%v\nStatus:%v\nContract:%x", r.TxHash, r.PostState, r.Fee, r.Status, r.ContractAddress)
+}
+
+type Receipts []*Receipt
+
+func NewReceiptsFromData(data []byte) Receipts {
+	decoder := ethutil.NewRlpValueFromBytes(data)
+
+	receipts := make(Receipts, decoder.Length())
+	for i := 0; i < decoder.Length(); i++ {
+		receipts[i] = NewReceiptFromRlpValue(decoder.Get(i))
+	}
+
+	return receipts
+}
+
+func (receipts Receipts) RlpEncode() []byte {
+	data := make([]interface{}, len(receipts))
+	for i, receipt := range receipts {
+		data[i] = receipt.RlpData()
+	}
+
+	return ethutil.Encode(data)
+}
@@ -0,0 +1,108 @@
+package ethchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+)
+
+// Account as stored in the state trie. Plain addresses and contracts share
+// the same layout, contracts have a storage root.
+type StateAccount struct {
+	Address []byte
+	Amount  *big.Int
+	Nonce   uint64
+	// Root of the contract's storage trie as stored in the account: the hash
+	// of the root node or the node itself if it's small enough to be inlined.
+	// Empty for plain addresses
+	StorageRoot interface{}
+}
+
+func NewStateAccountFromData(addr, data []byte) *StateAccount {
+	decoder := ethutil.NewRlpValueFromBytes(data)
+
+	return &StateAccount{
+		Address:     addr,
+		Amount:      decoder.Get(0).AsBigInt(),
+		Nonce:       decoder.Get(1).AsUint(),
+		StorageRoot: decoder.Get(2).AsRaw(),
+	}
+}
+
+func (a *StateAccount) IsContract() bool {
+	return !isEmptyNode(a.StorageRoot)
+}
+
+// Calls cb for every account in the state, ordered by address. Stops at the
+// first error returned by cb.
+func (s *StateReader) ForEachAccount(cb func(account *StateAccount) error) error {
+	return walkTrie(s.db, s.state.Root, &trieVisitor{
+		leaf: func(key, value []byte) error {
+			return cb(NewStateAccountFromData(key, value))
+		},
+	})
+}
+
+// Calls cb for every entry in the storage of a contract, ordered by key. The
+// storage of a contract holds both its instructions and the values it
+// stored, values are passed as they are stored (RLP encoded).
+func (s *StateReader) ForEachStorage(addr []byte, cb func(key, value []byte) error) error {
+	account := s.account(addr)
+	if account == nil {
+		return nil
+	}
+
+	return walkTrie(s.db, account.Get(2).AsRaw(), &trieVisitor{leaf: cb})
+}
+
+type accountDump struct {
+	Balance string            `json:"balance"`
+	Nonce   uint64            `json:"nonce"`
+	Root    string            `json:"root"`
+	Storage map[string]string `json:"storage"`
+}
+
+type stateDump struct {
+	Root     string                  `json:"root"`
+	Accounts map[string]*accountDump `json:"accounts"`
+}
+
+// Returns the whole state as JSON. Addresses, roots and storage entries are
+// hex encoded, balances are decimal.
+func (s *StateReader) Dump() ([]byte, error) {
+	dump := &stateDump{
+		Root:     hex.EncodeToString(nodeRefBytes(s.state.Root)),
+		Accounts: make(map[string]*accountDump),
+	}
+
+	err := s.ForEachAccount(func(account *StateAccount) error {
+		entry := &accountDump{
+			Balance: account.Amount.String(),
+			Nonce:   account.Nonce,
+			Root:    hex.EncodeToString(nodeRefBytes(account.StorageRoot)),
+			Storage: make(map[string]string),
+		}
+		dump.Accounts[hex.EncodeToString(account.Address)] = entry
+
+		return s.ForEachStorage(account.Address, func(key, value []byte) error {
+			entry.Storage[hex.EncodeToString(key)] = hex.EncodeToString(value)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(dump, "", "  ")
+}
+
+// Returns the hash of a node reference or the encoding of an inlined node
+func nodeRefBytes(ref interface{}) []byte {
+	if node, ok := ref.([]interface{}); ok {
+		return ethutil.Encode(node)
+	}
+
+	return nodeBytes(ref)
+}
@@ -0,0 +1,59 @@
+package ethchain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDumpState(t *testing.T) {
+	genesis, err := ParseGenesis([]byte(`{"difficulty": "0x400000", "alloc": {
+		"0000000000000000000000000000000000000001": {"balance": "5"},
+		"0000000000000000000000000000000000000002": {
+			"balance": "6",
+			"code": ["PUSH", "1", "STOP"],
+			"storage": {"1": "7", "2": "300"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm := newTestBlockManager(genesis)
+	defer bm.Stop()
+
+	state, err := bm.bc.StateAt(bm.bc.GenesisBlock().Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := state.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump stateDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(dump.Accounts))
+	}
+	if account := dump.Accounts["0000000000000000000000000000000000000001"]; account == nil || account.Balance != "5" || len(account.Storage) != 0 {
+		t.Errorf("expected a plain address with a balance of 5, got %+v", account)
+	}
+
+	contract := dump.Accounts["0000000000000000000000000000000000000002"]
+	if contract == nil {
+		t.Fatal("expected the contract in the dump")
+	}
+	// Three instructions and two values, RLP encoded. A value below 0x80
+	// is encoded as the single byte itself
+	if len(contract.Storage) != 5 {
+		t.Errorf("expected 5 storage entries, got %d", len(contract.Storage))
+	}
+	values := make(map[string]bool)
+	for _, value := range contract.Storage {
+		values[value] = true
+	}
+	for _, exp := range []string{"07", "82012c"} {
+		if !values[exp] {
+			t.Errorf("expected a storage value %s, got %v", exp, contract.Storage)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package ethchain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+	"log"
+)
+
+type PruneConfig struct {
+	// Amount of most recent canonical blocks whose state is kept. Chains
+	// can't be reorganised deeper than this once pruned
+	Recent uint64
+	// Numbers of blocks whose state is always kept. The genesis state is
+	// always kept
+	Checkpoints []uint64
+	// Prune every so many blocks
+	Interval uint64
+}
+
+func DefaultPruneConfig() PruneConfig {
+	return PruneConfig{Recent: 256, Interval: 64}
+}
+
+// The state pruner removes the trie nodes which are only reachable from the
+// state of old blocks. Trie nodes are shared between states, a node is only
+// deleted when none of the states that are kept can reach it.
+type StatePruner struct {
+	bc     *BlockChain
+	config PruneConfig
+	// Canonical blocks up to this number have had their state pruned
+	pruned uint64
+}
+
+var prunedKey = []byte("PrunedState")
+
+func NewStatePruner(bc *BlockChain, config PruneConfig) *StatePruner {
+	pruner := &StatePruner{bc: bc, config: config}
+
+	data, _ := bc.db.Get(prunedKey)
+	pruner.pruned = ethutil.BigD(data).Uint64()
+
+	return pruner
+}
+
+// Returns whether the state of the canonical block with the given number is
+// kept by the pruner
+func (p *StatePruner) keeps(number uint64, head uint64) bool {
+	if number == 1 || number+p.config.Recent > head {
+		return true
+	}
+
+	for _, checkpoint := range p.config.Checkpoints {
+		if checkpoint == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether it's time to prune after head was imported
+func (p *StatePruner) due(head uint64) bool {
+	return p.config.Interval == 0 || head%p.config.Interval == 0
+}
+
+// Deletes the trie nodes only reachable from states older than the most
+// recent blocks. Returns the amount of deleted nodes.
+func (p *StatePruner) Prune() (int, error) {
+	db, ok := p.bc.db.(keyDeleter)
+	if !ok {
+		return 0, errors.New("Database doesn't support deleting keys")
+	}
+
+	head := p.bc.Head().Number
+	if head <= p.config.Recent {
+		return 0, nil
+	}
+	until := head - p.config.Recent
+
+	// Mark every node reachable from the states that are kept
+	marked := make(map[string]bool)
+	mark := &trieVisitor{node: func(hash []byte) bool {
+		if marked[string(hash)] {
+			return false
+		}
+		marked[string(hash)] = true
+
+		return true
+	}}
+
+	var kept []uint64
+	kept = append(kept, 1)
+	kept = append(kept, p.config.Checkpoints...)
+	for number := until + 1; number <= head; number++ {
+		kept = append(kept, number)
+	}
+	for _, number := range kept {
+		if header := p.canonicalHeader(number); header != nil {
+			if err := walkState(p.bc.db, header.Root, mark); err != nil {
+				return 0, fmt.Errorf("Marking state of block #%d: %v", number, err)
+			}
+		}
+	}
+
+	// Sweep the nodes of the expired states which weren't marked. Nodes
+	// might already be gone from an earlier interrupted run, the sweep goes
+	// on past them
+	deleted, missing := 0, 0
+	sweep := &trieVisitor{
+		node: func(hash []byte) bool {
+			if marked[string(hash)] {
+				return false
+			}
+			// Shared between expired states
+			marked[string(hash)] = true
+
+			db.Delete(hash)
+			deleted++
+
+			return true
+		},
+		missing: func(hash []byte) {
+			missing++
+		},
+	}
+
+	for number := p.pruned + 1; number <= until; number++ {
+		if p.keeps(number, head) {
+			continue
+		}
+
+		if header := p.canonicalHeader(number); header != nil {
+			missing = 0
+			if err := walkState(p.bc.db, header.Root, sweep); err != nil {
+				log.Printf("[PRUNE] Sweeping state of block #%d failed: %v\n", number, err)
+			}
+			if missing > 0 {
+				log.Printf("[PRUNE] State of block #%d incomplete: %d node(s) missing\n", number, missing)
+			}
+		}
+	}
+
+	p.pruned = until
+	p.bc.db.Put(prunedKey, ethutil.NumberToBytes(until, 64))
+
+	log.Printf("[PRUNE] Pruned state up to block #%d. Deleted %d node(s)\n", until, deleted)
+
+	return deleted, nil
+}
+
+func (p *StatePruner) canonicalHeader(number uint64) *BlockHeader {
+	hash := p.bc.GetHashByNumber(number)
+	if hash == nil {
+		return nil
+	}
+
+	return p.bc.GetHeader(hash)
+}
+
+// Copies the canonical chain and the state of the blocks kept by config from
+// src over to dst, leaving everything else (side chains, unreachable trie
+// nodes) behind. Neither database may be in use by a running node. Once done
+// dst can replace src.
+func CompactDatabase(src, dst Database, config PruneConfig) error {
+	copyKey := func(key []byte) {
+		if data, _ := src.Get(key); len(data) != 0 {
+			dst.Put(key, data)
+		}
+	}
+
+	// Find the head
+	var head uint64
+	for {
+		if data, _ := src.Get(canonicalKey(head + 1)); len(data) == 0 {
+			break
+		}
+		head++
+	}
+	if head == 0 {
+		return errors.New("No canonical chain found")
+	}
+
+	pruner := &StatePruner{config: config}
+	copyNode := &trieVisitor{node: func(hash []byte) bool {
+		// Already copied together with everything below it
+		if data, _ := dst.Get(hash); len(data) != 0 {
+			return false
+		}
+		copyKey(hash)
+
+		return true
+	}}
+
+	for number := uint64(1); number <= head; number++ {
+		hash, _ := src.Get(canonicalKey(number))
+		data, _ := src.Get(hash)
+		if len(data) == 0 {
+			return fmt.Errorf("Block #%d (%x) missing", number, hash)
+		}
+
+		dst.Put(hash, data)
+		dst.Put(canonicalKey(number), hash)
+		for _, suffix := range []string{"Info", "TD", "Receipts"} {
+			copyKey(append(append([]byte{}, hash...), suffix...))
+		}
+
+		header := NewBlockHeaderFromRlpValue(ethutil.NewRlpValueFromBytes(data).Get(0))
+		txs := ethutil.NewRlpValueFromBytes(data).Get(1)
+		for i := 0; i < txs.Length(); i++ {
+			copyKey(txLookupKey(NewTransactionFromData(txs.Get(i).AsBytes()).Hash()))
+		}
+
+		if pruner.keeps(number, head) {
+			if err := walkState(src, header.Root, copyNode); err != nil {
+				return fmt.Errorf("Copying state of block #%d: %v", number, err)
+			}
+		}
+	}
+
+	copyKey([]byte("LastKnownTotalDifficulty"))
+	copyKey(headKey)
+	if head > config.Recent {
+		dst.Put(prunedKey, ethutil.NumberToBytes(head-config.Recent, 64))
+	}
+
+	log.Printf("[PRUNE] Compacted %d block(s)\n", head)
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompactDatabase(t *testing.T) {
+	bm := NewBlockManager(newSyncMemDatabase(), nil, nil)
+	bm.Pow = FakePow{}
+	defer bm.Stop()
+
+	chain := GenerateChain(bm.bc.GenesisBlock(), 6, nil)
+	for _, block := range chain {
+		if _, err := bm.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := newSyncMemDatabase()
+	if err := CompactDatabase(bm.bc.db, dst, PruneConfig{Recent: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The compacted database continues from the same head
+	compacted := NewBlockManager(dst, nil, nil)
+	compacted.Pow = FakePow{}
+	defer compacted.Stop()
+
+	head := compacted.bc.Head()
+	if head.Number != 7 || !bytes.Equal(head.Hash, chain[5].Hash()) {
+		t.Fatalf("expected head #7 (%x), got #%d (%x)", chain[5].Hash(), head.Number, head.Hash)
+	}
+	if err := compacted.VerifyChain(); err != nil {
+		t.Error(err)
+	}
+
+	next := GenerateChain(chain[5], 1, nil)[0]
+	if result, err := compacted.ProcessBlock(next); err != nil || result != Imported {
+		t.Errorf("expected the next block to be imported, got %v (%v)", result, err)
+	}
+}
+
+func TestPruneState(t *testing.T) {
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+	// Pruned by hand below
+	bm.Pruner = NewStatePruner(bm.bc, PruneConfig{Recent: 3, Checkpoints: []uint64{3}, Interval: 1000})
+
+	// Every block changes the sender and a new recipient
+	chain := GenerateChain(bm.bc.GenesisBlock(), 8, func(i int, gen *BlockGen) {
+		to := make([]byte, 20)
+		to[0] = byte(i + 1)
+		gen.AddTx(newTestTx(gen.TxNonce(testAddress()), to, 1))
+	})
+	for _, block := range chain {
+		if _, err := bm.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := bm.bc.db
+	root := func(number uint64) interface{} {
+		return bm.bc.GetHeader(bm.bc.GetHashByNumber(number)).Root
+	}
+	collect := func(numbers ...uint64) map[string]bool {
+		nodes := make(map[string]bool)
+		for _, number := range numbers {
+			walkState(db, root(number), &trieVisitor{
+				node: func(hash []byte) bool {
+					nodes[string(hash)] = true
+
+					return true
+				},
+				missing: func(hash []byte) {},
+			})
+		}
+
+		return nodes
+	}
+
+	// Head is #9, the states of #1, #3 and #7 to #9 are kept
+	kept := []uint64{1, 3, 7, 8, 9}
+	expired := []uint64{2, 4, 5, 6}
+	keptNodes := collect(kept...)
+
+	// A node already gone doesn't stop the sweep of the rest of the state
+	var gone []byte
+	walkState(db, root(5), &trieVisitor{node: func(hash []byte) bool {
+		if gone == nil && !keptNodes[string(hash)] && !bytes.Equal(hash, nodeBytes(root(5))) {
+			gone = hash
+		}
+
+		return gone == nil
+	}})
+	if gone == nil {
+		t.Fatal("expected state #5 to have nodes of its own")
+	}
+	bm.bc.db.(*syncMemDatabase).Delete(gone)
+
+	var swept []string
+	for hash := range collect(expired...) {
+		if !keptNodes[hash] {
+			swept = append(swept, hash)
+		}
+	}
+
+	deleted, err := bm.Pruner.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != len(swept) {
+		t.Errorf("expected %d deleted nodes, got %d", len(swept), deleted)
+	}
+	for _, hash := range swept {
+		if data, _ := db.Get([]byte(hash)); len(data) != 0 {
+			t.Errorf("expected node %x to be deleted", hash)
+		}
+	}
+
+	for _, number := range kept {
+		if err := walkState(db, root(number), &trieVisitor{}); err != nil {
+			t.Errorf("state of #%d: %v", number, err)
+		}
+	}
+	for _, number := range expired {
+		if err := walkState(db, root(number), &trieVisitor{}); err == nil {
+			t.Errorf("expected the state of #%d to be gone", number)
+		}
+	}
+}
+
+// Blocks on a parent whose state is gone are rejected
+func TestImportOnPrunedState(t *testing.T) {
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+	bm.Pruner = NewStatePruner(bm.bc, PruneConfig{Recent: 2, Interval: 1})
+
+	chain := GenerateChain(bm.bc.GenesisBlock(), 6, func(i int, gen *BlockGen) {
+		gen.AddTx(newTestTx(gen.TxNonce(testAddress()), ZeroHash160, 1))
+	})
+	for _, block := range chain {
+		if _, err := bm.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	side := GenerateChain(chain[1], 1, func(_ int, gen *BlockGen) {
+		gen.SetCoinbase([]byte{1})
+	})[0]
+	if result, err := bm.ProcessBlock(side); result != Invalid || !errors.Is(err, ErrStatePruned) {
+		t.Errorf("expected ErrStatePruned, got %v (%v)", result, err)
+	}
+	if bm.bc.HasBlock(side.Hash()) {
+		t.Error("expected the block not to be stored")
+	}
+}
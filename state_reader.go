@@ -0,0 +1,121 @@
+package ethchain
+
+import (
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+)
+
+// Read only view of the state of a block
+type StateReader struct {
+	// Hash of the block the state belongs to
+	BlockHash []byte
+	state     *ethutil.Trie
+	db        Database
+}
+
+// Returns a reader for the state of the block with the given hash. The block
+// may be on a side chain. Fails with an error wrapping ErrStatePruned if the
+// state is no longer available.
+func (bc *BlockChain) StateAt(hash []byte) (*StateReader, error) {
+	if !bc.HasBlock(hash) {
+		return nil, fmt.Errorf("Unknown block %x", hash)
+	}
+
+	root := bc.GetHeader(hash).Root
+	if _, err := loadNode(bc.db, root); err != nil {
+		return nil, fmt.Errorf("%w: block %x (%v)", ErrStatePruned, hash, err)
+	}
+
+	return &StateReader{BlockHash: hash, state: ethutil.NewTrie(bc.db, root), db: bc.db}, nil
+}
+
+// Returns a reader for the state of the canonical block with the given number
+func (bc *BlockChain) StateAtNumber(number uint64) (*StateReader, error) {
+	hash := bc.GetHashByNumber(number)
+	if hash == nil {
+		return nil, fmt.Errorf("Unknown block number %d", number)
+	}
+
+	return bc.StateAt(hash)
+}
+
+// Returns the RLP decoded account or nil if there's no such account
+func (s *StateReader) account(addr []byte) *ethutil.RlpValue {
+	data := s.state.Get(string(addr))
+	if data == "" {
+		return nil
+	}
+
+	return ethutil.NewRlpValueFromBytes([]byte(data))
+}
+
+// Returns the storage trie of a contract or nil if addr isn't a contract
+func (s *StateReader) storage(addr []byte) *ethutil.Trie {
+	account := s.account(addr)
+	if account == nil {
+		return nil
+	}
+
+	root := account.Get(2).AsRaw()
+	if isEmptyNode(root) {
+		return nil
+	}
+
+	return ethutil.NewTrie(s.db, root)
+}
+
+// Returns the balance of an address or contract. Unknown addresses have a
+// zero balance
+func (s *StateReader) Balance(addr []byte) *big.Int {
+	account := s.account(addr)
+	if account == nil {
+		return big.NewInt(0)
+	}
+
+	return account.Get(0).AsBigInt()
+}
+
+func (s *StateReader) Nonce(addr []byte) uint64 {
+	account := s.account(addr)
+	if account == nil {
+		return 0
+	}
+
+	return account.Get(1).AsUint()
+}
+
+// Returns the value a contract stored at key, the same value SLOAD would
+// load. Zero if nothing is stored or addr isn't a contract
+func (s *StateReader) Storage(addr []byte, key *big.Int) *big.Int {
+	storage := s.storage(addr)
+	if storage == nil {
+		return big.NewInt(0)
+	}
+
+	decoder := ethutil.NewRlpValueFromBytes([]byte(storage.Get(key.String())))
+	if decoder.IsNil() {
+		return big.NewInt(0)
+	}
+
+	return decoder.AsBigInt()
+}
+
+// Returns the instructions of a contract or nil if addr isn't a contract
+func (s *StateReader) Code(addr []byte) []string {
+	storage := s.storage(addr)
+	if storage == nil {
+		return nil
+	}
+
+	var code []string
+	for pc := uint64(0); ; pc++ {
+		instr := storage.Get(string(ethutil.NumberToBytes(pc, 32)))
+		if instr == "" {
+			break
+		}
+		code = append(code, instr)
+	}
+
+	return code
+}
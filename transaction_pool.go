@@ -8,6 +8,7 @@ import (
 	"github.com/ethereum/ethutil-go"
 	"github.com/ethereum/ethwire-go"
 	"log"
+	"math/big"
 	"sync"
 )
 
@@ -15,6 +16,7 @@ const (
 	txPoolQueueSize = 50
 )
 
+// Deprecated: subscribe to NewTxEvent on BlockManager.Events instead
 type TxPoolHook chan *Transaction
 
 func FindTx(pool *list.List, finder func(*Transaction, *list.Element) bool) *Transaction {
@@ -53,6 +55,10 @@ type TxPool struct {
 
 	BlockManager *BlockManager
 
+	// Receives the transactions added to the pool if set before Start.
+	// Transactions are dropped if the hook isn't read fast enough.
+	//
+	// Deprecated: subscribe to NewTxEvent on BlockManager.Events instead
 	Hook TxPoolHook
 }
 
@@ -73,7 +79,9 @@ func (pool *TxPool) addTransaction(tx *Transaction) {
 	pool.mutex.Unlock()
 
 	// Broadcast the transaction to the rest of the peers
-	pool.Speaker.Broadcast(ethwire.MsgTxTy, []interface{}{tx.RlpData()})
+	if pool.Speaker != nil {
+		pool.Speaker.Broadcast(ethwire.MsgTxTy, []interface{}{tx.RlpData()})
+	}
 }
 
 // Process transaction validates the Tx and processes funds from the
@@ -87,12 +95,7 @@ func (pool *TxPool) ProcessTransaction(tx *Transaction, block *Block) error {
 	// Make sure there's enough in the sender's account. Having insufficient
 	// funds won't invalidate this transaction but simple ignores it.
 	if sender.Amount.Cmp(tx.Value) < 0 {
-		if ethutil.Config.Debug {
-			log.Printf("Insufficient amount (ETH: %v) in sender's (%x) account. Adding 1 ETH for debug\n", sender.Amount, tx.Sender())
-			sender.Amount = ethutil.BigPow(10, 18)
-		} else {
-			return errors.New("Insufficient amount in sender's account")
-		}
+		return errors.New("Insufficient amount in sender's account")
 	}
 
 	// Subtract the amount from the senders account
@@ -109,10 +112,30 @@ func (pool *TxPool) ProcessTransaction(tx *Transaction, block *Block) error {
 	return nil
 }
 
+// Checks the transaction has the next nonce of its sender and increments it,
+// making each transaction valid only once to prevent replay attacks
+func useNonce(tx *Transaction, block *Block) error {
+	sender := block.GetAddr(tx.Sender())
+	if sender.Nonce != tx.Nonce {
+		return fmt.Errorf("Invalid nonce %d(%d)", tx.Nonce, sender.Nonce)
+	}
+
+	sender.Nonce += 1
+	block.UpdateAddr(tx.Sender(), sender)
+
+	return nil
+}
+
+// Charges the sender of the transaction the fee and credits it to the
+// block's coinbase
+func (pool *TxPool) PayTxFee(tx *Transaction, block *Block, fee *big.Int) error {
+	return block.PayFee(tx.Sender(), fee)
+}
+
 func (pool *TxPool) ValidateTransaction(tx *Transaction) error {
 	// Get the last block so we can retrieve the sender and receiver from
 	// the merkle trie
-	block := pool.BlockManager.BlockChain().CurrentBlock
+	block := pool.BlockManager.BlockChain().Head().Block
 	// Something has gone horribly wrong if this happens
 	if block == nil {
 		return errors.New("No last block on the block chain")
@@ -121,29 +144,20 @@ func (pool *TxPool) ValidateTransaction(tx *Transaction) error {
 	// Get the sender
 	sender := block.GetAddr(tx.Sender())
 
-	// Make sure there's enough in the sender's account. Having insufficient
-	// funds won't invalidate this transaction but simple ignores it.
-	if sender.Amount.Cmp(tx.Value) < 0 {
-		if ethutil.Config.Debug {
-			log.Printf("Insufficient amount (ETH: %v) in sender's (%x) account. Adding 1 ETH for debug\n", sender.Amount, tx.Sender())
-		} else {
-			return errors.New("Insufficient amount in sender's account")
-		}
+	// Make sure there's enough in the sender's account to pay the value and
+	// the fee
+	cost := new(big.Int).Add(tx.Value, CalculateTxFee(tx))
+	if sender.Amount.Cmp(cost) < 0 {
+		return errors.New("Insufficient amount in sender's account")
 	}
 
-	if sender.Nonce != tx.Nonce {
-		if ethutil.Config.Debug {
-			return fmt.Errorf("Invalid nonce %d(%d) continueing anyway", tx.Nonce, sender.Nonce)
-		} else {
-			return fmt.Errorf("Invalid nonce %d(%d)", tx.Nonce, sender.Nonce)
-		}
+	// A lower nonce has been used already. Higher ones are accepted, the
+	// transactions before them might still be pending. The nonce is only
+	// incremented when the transaction is applied to a block
+	if tx.Nonce < sender.Nonce {
+		return fmt.Errorf("Invalid nonce %d(%d)", tx.Nonce, sender.Nonce)
 	}
 
-	// Increment the nonce making each tx valid only once to prevent replay
-	// attacks
-	sender.Nonce += 1
-	block.UpdateAddr(tx.Sender(), sender)
-
 	return nil
 }
 
@@ -153,9 +167,11 @@ out:
 		select {
 		case tx := <-pool.queueChan:
 			hash := tx.Hash()
+			pool.mutex.Lock()
 			foundTx := FindTx(pool.pool, func(tx *Transaction, e *list.Element) bool {
 				return bytes.Compare(tx.Hash(), hash) == 0
 			})
+			pool.mutex.Unlock()
 
 			if foundTx != nil {
 				break
@@ -172,8 +188,8 @@ out:
 				// doesn't matter since this is a goroutine
 				pool.addTransaction(tx)
 
-				if pool.Hook != nil {
-					pool.Hook <- tx
+				if pool.BlockManager != nil {
+					pool.BlockManager.Events.Post(NewTxEvent{Tx: tx})
 				}
 			}
 		case <-pool.quit:
@@ -209,6 +225,29 @@ func (pool *TxPool) Flush() []*Transaction {
 
 func (pool *TxPool) Start() {
 	go pool.queueHandler()
+
+	if pool.Hook != nil && pool.BlockManager != nil {
+		go pool.hookHandler(pool.BlockManager.Events.Subscribe(txPoolQueueSize, NewTxEvent{}))
+	}
+}
+
+// Feeds the deprecated hook from the event mux until the pool is stopped
+func (pool *TxPool) hookHandler(sub *Subscription) {
+	defer sub.Unsubscribe()
+
+out:
+	for {
+		select {
+		case ev := <-sub.Chan():
+			select {
+			case pool.Hook <- ev.(NewTxEvent).Tx:
+			case <-pool.quit:
+				break out
+			}
+		case <-pool.quit:
+			break out
+		}
+	}
 }
 
 func (pool *TxPool) Stop() {
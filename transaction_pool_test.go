@@ -0,0 +1,105 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestNewBlockSkipsInvalidTxs(t *testing.T) {
+	// New blocks are made at the current time
+	genesis := newTestGenesis()
+	genesis.Time = time.Now().Unix() - 10
+	bm := newTestBlockManager(genesis)
+	defer bm.Stop()
+
+	to := make([]byte, 20)
+	to[0] = 1
+	first := newTestTx(0, to, 1)
+	second := newTestTx(1, to, 2)
+	// A replay of the first transaction and one leaving a nonce gap
+	gapped := newTestTx(3, to, 4)
+	block := bm.NewBlock(ZeroHash160, []*Transaction{first, first, gapped, second})
+
+	txs := block.Transactions()
+	if len(txs) != 2 || txs[0] != first || txs[1] != second {
+		t.Fatalf("expected the first and second transactions, got %d", len(txs))
+	}
+	if result, err := bm.ProcessBlock(block); err != nil || result != Imported {
+		t.Fatalf("expected the block to be imported, got %v (%v)", result, err)
+	}
+
+	head := bm.bc.CurrentBlock
+	if nonce := head.GetAddr(testAddress()).Nonce; nonce != 2 {
+		t.Errorf("expected nonce 2, got %d", nonce)
+	}
+	if balance := head.GetAddr(to).Amount.Int64(); balance != 3 {
+		t.Errorf("expected a balance of 3, got %d", balance)
+	}
+}
+
+// A contract creation which is left out leaves no contract behind
+func TestNewBlockSkipsContract(t *testing.T) {
+	genesis := newTestGenesis()
+	genesis.Time = time.Now().Unix() - 10
+	bm := newTestBlockManager(genesis)
+	defer bm.Stop()
+
+	transfer := newTestTx(0, ZeroHash160, 1)
+	contract := NewTransaction(nil, big.NewInt(1), []string{"PUSH", "1", "STOP"})
+	contract.Nonce = 7
+	contract.Sign(testKey)
+	block := bm.NewBlock(ZeroHash160, []*Transaction{transfer, contract})
+
+	if txs := block.Transactions(); len(txs) != 1 || txs[0] != transfer {
+		t.Fatalf("expected only the transfer, got %d transactions", len(txs))
+	}
+	if block.GetContract(contract.Hash()) != nil {
+		t.Error("expected the contract not to exist")
+	}
+	if result, err := bm.ProcessBlock(block); err != nil || result != Imported {
+		t.Fatalf("expected the block to be imported, got %v (%v)", result, err)
+	}
+}
+
+func TestReplayedTx(t *testing.T) {
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+
+	tx := newTestTx(0, ZeroHash160, 1)
+	block := GenerateChain(bm.bc.GenesisBlock(), 1, func(_ int, gen *BlockGen) {
+		gen.AddTx(tx)
+	})[0]
+	if _, err := bm.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same transaction in the next block
+	replay := GenerateChain(block, 1, nil)[0]
+	replay.SetTransactions([]*Transaction{tx})
+	if result, err := bm.ProcessBlock(replay); result != Invalid || !errors.Is(err, ErrInvalidTx) {
+		t.Errorf("expected ErrInvalidTx, got %v (%v)", result, err)
+	}
+	if !bytes.Equal(bm.bc.Head().Hash, block.Hash()) {
+		t.Error("expected the head to stay the same")
+	}
+}
+
+// Transactions entering the pool leave the chain's state alone
+func TestValidateTransactionReadOnly(t *testing.T) {
+	bm := newTestBlockManager(newTestGenesis())
+	defer bm.Stop()
+	pool := NewTxPool()
+	pool.BlockManager = bm
+
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		if err := pool.ValidateTransaction(newTestTx(nonce, ZeroHash160, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if nonce := bm.bc.CurrentBlock.GetAddr(testAddress()).Nonce; nonce != 0 {
+		t.Errorf("expected nonce 0, got %d", nonce)
+	}
+}
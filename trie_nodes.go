@@ -0,0 +1,215 @@
+package ethchain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+)
+
+// Trie nodes are either stored in the database by the hash of their encoding
+// or, when the encoding is shorter than 32 bytes, inlined in their parent.
+// The helpers in this file walk the nodes as they are stored without going
+// through ethutil.Trie.
+
+// Returns the database key of a node reference or nil if the node is inlined
+// (or empty)
+func nodeHash(ref interface{}) []byte {
+	if hash := nodeBytes(ref); len(hash) == 32 {
+		return hash
+	}
+
+	return nil
+}
+
+// Returns the bytes of a decoded string item. The RLP decoder returns a
+// single byte below 0x80 as a byte, nodes built in memory may hold numbers.
+// Returns nil for lists.
+func nodeBytes(v interface{}) []byte {
+	switch b := v.(type) {
+	case string:
+		return []byte(b)
+	case []byte:
+		return b
+	case byte:
+		return []byte{b}
+	case uint16:
+		return new(big.Int).SetUint64(uint64(b)).Bytes()
+	case uint32:
+		return new(big.Int).SetUint64(uint64(b)).Bytes()
+	case uint64:
+		return new(big.Int).SetUint64(b).Bytes()
+	case uint:
+		return new(big.Int).SetUint64(uint64(b)).Bytes()
+	case int:
+		return big.NewInt(int64(b)).Bytes()
+	case int64:
+		return big.NewInt(b).Bytes()
+	case *big.Int:
+		return b.Bytes()
+	}
+
+	return nil
+}
+
+// Returns whether a node reference points to the empty node
+func isEmptyNode(ref interface{}) bool {
+	if _, ok := ref.([]interface{}); ok {
+		return false
+	}
+
+	return len(nodeBytes(ref)) == 0
+}
+
+var errMissingNode = errors.New("Missing trie node")
+
+// Resolves a node reference. Returns nil for the empty node
+func loadNode(db ethutil.Database, ref interface{}) ([]interface{}, error) {
+	if hash := nodeHash(ref); hash != nil {
+		data, _ := db.Get(hash)
+		if len(data) == 0 {
+			return nil, fmt.Errorf("%w %x", errMissingNode, hash)
+		}
+		ref = ethutil.NewRlpValueFromBytes(data).Value
+	}
+
+	switch node := ref.(type) {
+	case []interface{}:
+		if len(node) != 2 && len(node) != 17 {
+			return nil, fmt.Errorf("Malformed trie node with %d items", len(node))
+		}
+
+		return node, nil
+	}
+
+	if len(nodeBytes(ref)) != 0 {
+		return nil, fmt.Errorf("Malformed trie node reference %x", ref)
+	}
+
+	return nil, nil
+}
+
+// Decodes a hex prefix encoded key into its nibbles and whether the node is a
+// leaf (as opposed to an extension)
+func compactDecode(key []byte) ([]int, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+
+	flag := int(key[0] >> 4)
+	var nibbles []int
+	if flag&1 == 1 {
+		nibbles = append(nibbles, int(key[0]&0x0f))
+	}
+	for _, b := range key[1:] {
+		nibbles = append(nibbles, int(b>>4), int(b&0x0f))
+	}
+
+	return nibbles, flag&2 == 2
+}
+
+// Splits a key into nibbles
+func keyNibbles(key []byte) []int {
+	nibbles := make([]int, len(key)*2)
+	for i, b := range key {
+		nibbles[i*2] = int(b >> 4)
+		nibbles[i*2+1] = int(b & 0x0f)
+	}
+
+	return nibbles
+}
+
+// Joins nibbles back into a key
+func nibblesToKey(nibbles []int) []byte {
+	key := make([]byte, len(nibbles)/2)
+	for i := range key {
+		key[i] = byte(nibbles[i*2]<<4 | nibbles[i*2+1])
+	}
+
+	return key
+}
+
+type trieVisitor struct {
+	// Called for each node stored in the database. Returning false skips
+	// everything below the node. May be nil
+	node func(hash []byte) bool
+	// Called for each value with the key it's stored under. May be nil
+	leaf func(key, value []byte) error
+	// Called for each node missing from the database, the walk goes on with
+	// the next node. The walk fails on missing nodes if nil
+	missing func(hash []byte)
+}
+
+// Walks the trie starting at ref
+func walkTrie(db ethutil.Database, ref interface{}, visitor *trieVisitor) error {
+	return walkNode(db, ref, nil, visitor)
+}
+
+func walkNode(db ethutil.Database, ref interface{}, path []int, visitor *trieVisitor) error {
+	node, err := loadNode(db, ref)
+	if errors.Is(err, errMissingNode) && visitor.missing != nil {
+		visitor.missing(nodeHash(ref))
+
+		return nil
+	}
+	if err != nil || node == nil {
+		return err
+	}
+
+	if hash := nodeHash(ref); hash != nil && visitor.node != nil && !visitor.node(hash) {
+		return nil
+	}
+
+	if len(node) == 2 {
+		nibbles, leaf := compactDecode(nodeBytes(node[0]))
+		key := append(append([]int{}, path...), nibbles...)
+		if leaf {
+			if visitor.leaf != nil {
+				return visitor.leaf(nibblesToKey(key), nodeBytes(node[1]))
+			}
+
+			return nil
+		}
+
+		return walkNode(db, node[1], key, visitor)
+	}
+
+	for i := 0; i < 16; i++ {
+		if err := walkNode(db, node[i], append(append([]int{}, path...), i), visitor); err != nil {
+			return err
+		}
+	}
+	if value := nodeBytes(node[16]); len(value) != 0 && visitor.leaf != nil {
+		return visitor.leaf(nibblesToKey(path), value)
+	}
+
+	return nil
+}
+
+// Returns the storage root of an account as stored in the state trie. Plain
+// addresses have an empty storage root
+func accountStorageRoot(value []byte) interface{} {
+	return ethutil.NewRlpValueFromBytes(value).Get(2).AsRaw()
+}
+
+// Walks the state trie starting at root including the storage trie of every
+// contract in it. The leaf callback is only called for accounts.
+func walkState(db ethutil.Database, root interface{}, visitor *trieVisitor) error {
+	storage := &trieVisitor{node: visitor.node, missing: visitor.missing}
+
+	return walkTrie(db, root, &trieVisitor{
+		node:    visitor.node,
+		missing: visitor.missing,
+		leaf: func(key, value []byte) error {
+			if err := walkTrie(db, accountStorageRoot(value), storage); err != nil {
+				return err
+			}
+
+			if visitor.leaf != nil {
+				return visitor.leaf(key, value)
+			}
+
+			return nil
+		},
+	})
+}
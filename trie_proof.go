@@ -0,0 +1,153 @@
+package ethchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/ethutil-go"
+)
+
+// A Merkle proof is the list of encoded trie nodes on the path from the root
+// to a key, in that order. Nodes which are inlined in their parent aren't
+// part of the proof, they're contained in the parent's encoding.
+
+// Returns the proof of the value (or absence) of key in trie whose nodes are
+// stored in db
+func ProveTrie(db Database, trie *ethutil.Trie, key []byte) ([][]byte, error) {
+	var proof [][]byte
+
+	err := followKey(trie.Root, key, func(hash []byte) ([]interface{}, error) {
+		node, err := loadNode(db, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		data, _ := db.Get(hash)
+		proof = append(proof, data)
+
+		return node, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return proof, nil
+}
+
+// Returns the proof of the account at addr in the state of the block
+func (block *Block) ProveAccount(addr []byte) ([][]byte, error) {
+	return ProveTrie(block.db, block.State(), addr)
+}
+
+// Returns the proof of the storage entry at key of the contract. The
+// contract's storage root is the root of the proof, combine it with the proof
+// of the contract's account to prove the entry against a block's state root.
+func (c *Contract) ProveStorage(key []byte) ([][]byte, error) {
+	return ProveTrie(c.db, c.State(), key)
+}
+
+// Verifies the proof of key against root and returns the value stored at key,
+// nil if the proof shows key is absent. Root is either the hash of the root
+// node or an inlined root node as found in an account's storage root. No
+// database is needed.
+func VerifyProof(root interface{}, key []byte, proof [][]byte) ([]byte, error) {
+	var value []byte
+
+	err := followKey(root, key, func(hash []byte) ([]interface{}, error) {
+		if len(proof) == 0 {
+			return nil, errors.New("Proof is incomplete")
+		}
+
+		data := proof[0]
+		proof = proof[1:]
+		if !bytes.Equal(ethutil.Sha3Bin(data), hash) {
+			return nil, fmt.Errorf("Proof node doesn't match hash %x", hash)
+		}
+
+		node, ok := ethutil.NewRlpValueFromBytes(data).Value.([]interface{})
+		if !ok || (len(node) != 2 && len(node) != 17) {
+			return nil, fmt.Errorf("Malformed proof node %x", hash)
+		}
+
+		return node, nil
+	}, func(v []byte) {
+		value = v
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(proof) != 0 {
+		return nil, fmt.Errorf("Proof has %d unused node(s)", len(proof))
+	}
+
+	return value, nil
+}
+
+// Follows the path of key starting at ref. Resolve is called for every node
+// referenced by hash, found with the value at key if there is one.
+func followKey(ref interface{}, key []byte, resolve func(hash []byte) ([]interface{}, error), found func(value []byte)) error {
+	path := keyNibbles(key)
+
+	for {
+		var node []interface{}
+		if hash := nodeHash(ref); hash != nil {
+			var err error
+			if node, err = resolve(hash); err != nil {
+				return err
+			}
+		} else if n, ok := ref.([]interface{}); ok {
+			node = n
+		} else if len(nodeBytes(ref)) == 0 {
+			// Empty node, the key is absent
+			return nil
+		} else {
+			return fmt.Errorf("Malformed trie node reference %x", ref)
+		}
+
+		switch len(node) {
+		case 2:
+			nibbles, leaf := compactDecode(nodeBytes(node[0]))
+			if leaf {
+				if nibblesEqual(nibbles, path) && found != nil {
+					found(nodeBytes(node[1]))
+				}
+
+				return nil
+			}
+
+			if len(path) < len(nibbles) || !nibblesEqual(nibbles, path[:len(nibbles)]) {
+				return nil
+			}
+			path = path[len(nibbles):]
+			ref = node[1]
+		case 17:
+			if len(path) == 0 {
+				if value := nodeBytes(node[16]); len(value) != 0 && found != nil {
+					found(value)
+				}
+
+				return nil
+			}
+
+			ref = node[path[0]]
+			path = path[1:]
+		default:
+			return fmt.Errorf("Malformed trie node with %d items", len(node))
+		}
+	}
+}
+
+func nibblesEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
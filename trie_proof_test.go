@@ -0,0 +1,152 @@
+package ethchain
+
+import (
+	"bytes"
+	"github.com/ethereum/ethutil-go"
+	"math/big"
+	"testing"
+)
+
+func TestProveAccount(t *testing.T) {
+	genesis := DefaultGenesis()
+	for i := 1; i <= 30; i++ {
+		addr := make([]byte, 20)
+		addr[0] = byte(i)
+		genesis.Alloc[string(addr)] = &GenesisAccount{Balance: big.NewInt(int64(100 + i))}
+	}
+	block := genesis.Block(newSyncMemDatabase())
+	root := block.State().Root
+
+	for i := 1; i <= 32; i++ {
+		addr := make([]byte, 20)
+		addr[0] = byte(i)
+		proof, err := block.ProveAccount(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := VerifyProof(root, addr, proof)
+		if err != nil {
+			t.Fatalf("account %x: %v", addr, err)
+		}
+		// The last two accounts don't exist
+		if i > 30 {
+			if value != nil {
+				t.Errorf("account %x: expected to be absent, got %x", addr, value)
+			}
+			continue
+		}
+		if value == nil {
+			t.Fatalf("account %x: expected to be present", addr)
+		}
+		if amount := NewAddressFromData(value).Amount; amount.Cmp(big.NewInt(int64(100+i))) != 0 {
+			t.Errorf("account %x: expected a balance of %d, got %v", addr, 100+i, amount)
+		}
+	}
+}
+
+func TestVerifyInvalidProof(t *testing.T) {
+	genesis := DefaultGenesis()
+	for i := 1; i <= 30; i++ {
+		addr := make([]byte, 20)
+		addr[0] = byte(i)
+		genesis.Alloc[string(addr)] = &GenesisAccount{Balance: big.NewInt(1)}
+	}
+	block := genesis.Block(newSyncMemDatabase())
+	root := block.State().Root
+
+	addr := make([]byte, 20)
+	addr[0] = 1
+	proof, err := block.ProveAccount(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof) < 2 {
+		t.Fatalf("expected a proof of several nodes, got %d", len(proof))
+	}
+
+	tampered := append([][]byte{}, proof...)
+	last := append([]byte{}, proof[len(proof)-1]...)
+	last[len(last)-1] ^= 1
+	tampered[len(tampered)-1] = last
+
+	for name, proof := range map[string][][]byte{
+		"tampered":  tampered,
+		"truncated": proof[:len(proof)-1],
+		"extended":  append(append([][]byte{}, proof...), proof[0]),
+		"empty":     nil,
+	} {
+		if _, err := VerifyProof(root, addr, proof); err == nil {
+			t.Errorf("%s proof: expected an error", name)
+		}
+	}
+
+	// A proof only holds for its own root
+	if _, err := VerifyProof(ethutil.Sha3Bin([]byte("root")), addr, proof); err == nil {
+		t.Error("expected an error verifying against another root")
+	}
+}
+
+func TestProveStorage(t *testing.T) {
+	contract := NewContract(newSyncMemDatabase(), big.NewInt(1), nil)
+	for i := 0; i < 50; i++ {
+		contract.State().Update(big.NewInt(int64(i)).String(), string(ethutil.Encode(big.NewInt(int64(i*7)))))
+	}
+	root := contract.State().Root
+
+	for i := 0; i < 55; i++ {
+		key := []byte(big.NewInt(int64(i)).String())
+		proof, err := contract.ProveStorage(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := VerifyProof(root, key, proof)
+		if err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+		if i >= 50 {
+			if value != nil {
+				t.Errorf("key %s: expected to be absent, got %x", key, value)
+			}
+			continue
+		}
+		if n := ethutil.NewRlpValueFromBytes(value).AsBigInt(); n.Cmp(big.NewInt(int64(i*7))) != 0 {
+			t.Errorf("key %s: expected %d, got %v", key, i*7, n)
+		}
+	}
+}
+
+func TestProveInlinedStorage(t *testing.T) {
+	contract := NewContract(newSyncMemDatabase(), big.NewInt(1), nil)
+	contract.State().Update("1", string(ethutil.Encode(big.NewInt(7))))
+
+	// A storage trie this small is inlined in the account
+	root := contract.State().Root
+	if nodeHash(root) != nil {
+		t.Fatalf("expected an inlined storage root, got %x", root)
+	}
+
+	for key, exp := range map[string][]byte{"1": ethutil.Encode(big.NewInt(7)), "2": nil} {
+		proof, err := contract.ProveStorage([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof) != 0 {
+			t.Errorf("key %s: expected an empty proof, got %d node(s)", key, len(proof))
+		}
+
+		value, err := VerifyProof(root, []byte(key), proof)
+		if err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+		if !bytes.Equal(value, exp) {
+			t.Errorf("key %s: expected %x, got %x", key, exp, value)
+		}
+	}
+
+	// Nodes which aren't needed aren't accepted either
+	if _, err := VerifyProof(root, []byte("1"), [][]byte{ethutil.Encode([]interface{}{"", ""})}); err == nil {
+		t.Error("expected an error for a proof with unused nodes")
+	}
+}
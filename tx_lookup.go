@@ -0,0 +1,64 @@
+package ethchain
+
+import (
+	"errors"
+	"github.com/ethereum/ethutil-go"
+)
+
+// Position of a transaction in the canonical chain
+type TxLookup struct {
+	BlockHash   []byte
+	BlockNumber uint64
+	// Index of the transaction within the block
+	Index uint64
+}
+
+func (l *TxLookup) RlpDecode(data []byte) {
+	decoder := ethutil.NewRlpValueFromBytes(data)
+	l.BlockHash = decoder.Get(0).AsBytes()
+	l.BlockNumber = decoder.Get(1).AsUint()
+	l.Index = decoder.Get(2).AsUint()
+}
+
+func (l *TxLookup) RlpEncode() []byte {
+	return ethutil.Encode([]interface{}{l.BlockHash, l.BlockNumber, l.Index})
+}
+
+// Returns the transaction with the given hash and its position in the
+// canonical chain
+func (bc *BlockChain) GetTransaction(hash []byte) (*Transaction, *TxLookup, error) {
+	data, _ := bc.db.Get(txLookupKey(hash))
+	if len(data) == 0 {
+		return nil, nil, errors.New("Transaction not found")
+	}
+
+	lookup := &TxLookup{}
+	lookup.RlpDecode(data)
+
+	txs := bc.GetBlock(lookup.BlockHash).Transactions()
+	if lookup.Index >= uint64(len(txs)) {
+		return nil, nil, errors.New("Transaction lookup points outside of the block")
+	}
+
+	return txs[lookup.Index], lookup, nil
+}
+
+func txLookupKey(hash []byte) []byte {
+	return append(hash, []byte("Lookup")...)
+}
+
+// Indexes the transactions of a block that became canonical
+func (bc *BlockChain) writeTxLookups(batch Batch, block *Block, number uint64) {
+	for i, tx := range block.Transactions() {
+		lookup := TxLookup{BlockHash: block.Hash(), BlockNumber: number, Index: uint64(i)}
+		batch.Put(txLookupKey(tx.Hash()), lookup.RlpEncode())
+	}
+}
+
+// Removes the index of the transactions of a block that left the canonical
+// chain
+func (bc *BlockChain) deleteTxLookups(batch Batch, block *Block) {
+	for _, tx := range block.Transactions() {
+		batch.Delete(txLookupKey(tx.Hash()))
+	}
+}